@@ -69,6 +69,53 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// ThrowStatement raises Value as an error, to be caught by the nearest
+// enclosing try.
+type ThrowStatement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// ImportStatement binds the exports of the module at Path to Name, as in
+// `import "lib.mk" as lib;`.
+type ImportStatement struct {
+	Token token.Token
+	Path  *StringLiteral
+	Name  *Identifier
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return fmt.Sprintf("%s %q as %s;", is.TokenLiteral(), is.Path.Value, is.Name.String())
+}
+
+// ExportStatement is a top-level let that importers of the module can see.
+type ExportStatement struct {
+	Token token.Token
+	Let   *LetStatement
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Let.String()
+}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -89,9 +136,23 @@ type Expression interface {
 	expressionNode()
 }
 
+// IdentifierKind records what an identifier was resolved to before
+// evaluation. Unresolved identifiers are looked up by name at runtime.
+type IdentifierKind int
+
+const (
+	Unresolved IdentifierKind = iota
+	Variable                  // Depth environments out, at Slot
+	Builtin                   // the evaluator's builtins[Slot]
+)
+
 type Identifier struct {
 	Token token.Token
 	Value string
+
+	Kind  IdentifierKind
+	Depth int
+	Slot  int
 }
 
 func (i *Identifier) expressionNode()      {}
@@ -159,15 +220,52 @@ func (ie *IndexExpression) String() string {
 	return fmt.Sprintf("(%s[%s])", ie.Left.String(), ie.Index.String())
 }
 
+// MemberExpression looks up Member on Object, as in `lib.helper`, or names
+// the method called by a call like `xs.map(f)`.
+type MemberExpression struct {
+	Token  token.Token
+	Object Expression
+	Member *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	return fmt.Sprintf("(%s.%s)", me.Object.String(), me.Member.String())
+}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
 	Right    Expression
 }
 
+type SetLiteral struct {
+	Token    token.Token
+	Elements []Expression
+}
+
+func (sl *SetLiteral) expressionNode()      {}
+func (sl *SetLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *SetLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, elem := range sl.Elements {
+		elements = append(elements, elem.String())
+	}
+
+	out.WriteString("#{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	Keys  []Expression // the keys of Pairs, in source order
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -176,8 +274,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -231,6 +329,55 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+type ForExpression struct {
+	Token    token.Token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fe *ForExpression) expressionNode()      {}
+func (fe *ForExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *ForExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	out.WriteString(fe.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fe.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fe.Body.String())
+
+	return out.String()
+}
+
+// TryExpression runs Block, then Catch with the error bound to Parameter if
+// Block failed, then Finally either way. Catch or Finally may be missing, but
+// not both.
+type TryExpression struct {
+	Token     token.Token
+	Block     *BlockStatement
+	Parameter *Identifier
+	Catch     *BlockStatement
+	Finally   *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try " + te.Block.String())
+	if te.Catch != nil {
+		out.WriteString(" catch (" + te.Parameter.String() + ") " + te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally " + te.Finally.String())
+	}
+
+	return out.String()
+}
+
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
@@ -256,10 +403,39 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, param := range ml.Parameters {
+		params = append(params, param.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+
+	// Tail is set when the call's result is returned straight from the
+	// enclosing function, so it can be made without growing the stack.
+	Tail bool
 }
 
 func (ce *CallExpression) expressionNode()      {}
@@ -0,0 +1,340 @@
+package ast
+
+import "fmt"
+
+type ModifierFunc func(Node) Node
+
+// Modify rewrites node bottom-up, replacing every child with the result of
+// calling modifier on it before finally calling modifier on node itself. A
+// replacement that doesn't fit the slot it came from (e.g. a statement
+// returned for a function parameter) is discarded and the original kept.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		for i, stmt := range node.Statements {
+			node.Statements[i] = modifyStatement(stmt, modifier)
+		}
+
+	case *BlockStatement:
+		for i, stmt := range node.Statements {
+			node.Statements[i] = modifyStatement(stmt, modifier)
+		}
+
+	case *ExpressionStatement:
+		node.Expression = modifyExpression(node.Expression, modifier)
+
+	case *LetStatement:
+		node.Name = modifyIdentifier(node.Name, modifier)
+		node.Value = modifyExpression(node.Value, modifier)
+
+	case *ReturnStatement:
+		node.ReturnValue = modifyExpression(node.ReturnValue, modifier)
+
+	case *ThrowStatement:
+		node.Value = modifyExpression(node.Value, modifier)
+
+	case *ImportStatement:
+		if path, ok := Modify(node.Path, modifier).(*StringLiteral); ok {
+			node.Path = path
+		}
+		node.Name = modifyIdentifier(node.Name, modifier)
+
+	case *ExportStatement:
+		if let, ok := Modify(node.Let, modifier).(*LetStatement); ok {
+			node.Let = let
+		}
+
+	case *Identifier, *IntegerLiteral, *StringLiteral, *BooleanLiteral:
+		// leaves :)
+
+	case *PrefixExpression:
+		node.Right = modifyExpression(node.Right, modifier)
+
+	case *InfixExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Right = modifyExpression(node.Right, modifier)
+
+	case *IndexExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Index = modifyExpression(node.Index, modifier)
+
+	case *MemberExpression:
+		node.Object = modifyExpression(node.Object, modifier)
+		node.Member = modifyIdentifier(node.Member, modifier)
+
+	case *IfExpression:
+		node.Condition = modifyExpression(node.Condition, modifier)
+		node.Consequence = modifyBlock(node.Consequence, modifier)
+		if node.Alternative != nil {
+			node.Alternative = modifyBlock(node.Alternative, modifier)
+		}
+
+	case *ForExpression:
+		node.Variable = modifyIdentifier(node.Variable, modifier)
+		node.Iterable = modifyExpression(node.Iterable, modifier)
+		node.Body = modifyBlock(node.Body, modifier)
+
+	case *TryExpression:
+		node.Block = modifyBlock(node.Block, modifier)
+		if node.Catch != nil {
+			node.Parameter = modifyIdentifier(node.Parameter, modifier)
+			node.Catch = modifyBlock(node.Catch, modifier)
+		}
+		if node.Finally != nil {
+			node.Finally = modifyBlock(node.Finally, modifier)
+		}
+
+	case *FunctionLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i] = modifyIdentifier(param, modifier)
+		}
+		node.Body = modifyBlock(node.Body, modifier)
+
+	case *MacroLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i] = modifyIdentifier(param, modifier)
+		}
+		node.Body = modifyBlock(node.Body, modifier)
+
+	case *CallExpression:
+		node.Function = modifyExpression(node.Function, modifier)
+		for i, arg := range node.Arguments {
+			node.Arguments[i] = modifyExpression(arg, modifier)
+		}
+
+	case *ArrayLiteral:
+		for i, elem := range node.Elements {
+			node.Elements[i] = modifyExpression(elem, modifier)
+		}
+
+	case *SetLiteral:
+		for i, elem := range node.Elements {
+			node.Elements[i] = modifyExpression(elem, modifier)
+		}
+
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression, len(node.Pairs))
+		for i, key := range node.Keys {
+			value := node.Pairs[key]
+			node.Keys[i] = modifyExpression(key, modifier)
+			pairs[node.Keys[i]] = modifyExpression(value, modifier)
+		}
+		node.Pairs = pairs
+
+	default:
+		panic(fmt.Sprintf("ast.Modify: unexpected node type %T", node))
+	}
+
+	return modifier(node)
+}
+
+func modifyStatement(stmt Statement, modifier ModifierFunc) Statement {
+	if stmt == nil {
+		return nil
+	}
+	if modified, ok := Modify(stmt, modifier).(Statement); ok {
+		return modified
+	}
+	return stmt
+}
+
+func modifyExpression(expr Expression, modifier ModifierFunc) Expression {
+	if expr == nil {
+		return nil
+	}
+	if modified, ok := Modify(expr, modifier).(Expression); ok {
+		return modified
+	}
+	return expr
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if modified, ok := Modify(block, modifier).(*BlockStatement); ok {
+		return modified
+	}
+	return block
+}
+
+func modifyIdentifier(ident *Identifier, modifier ModifierFunc) *Identifier {
+	if modified, ok := Modify(ident, modifier).(*Identifier); ok {
+		return modified
+	}
+	return ident
+}
+
+// Copy returns a deep copy of node, so it can be rewritten without affecting
+// the original.
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		return &Program{Statements: copyStatements(node.Statements)}
+
+	case *BlockStatement:
+		return copyBlock(node)
+
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: node.Token, Expression: copyExpression(node.Expression)}
+
+	case *LetStatement:
+		return &LetStatement{Token: node.Token, Name: copyIdentifier(node.Name), Value: copyExpression(node.Value)}
+
+	case *ReturnStatement:
+		return &ReturnStatement{Token: node.Token, ReturnValue: copyExpression(node.ReturnValue)}
+
+	case *ThrowStatement:
+		return &ThrowStatement{Token: node.Token, Value: copyExpression(node.Value)}
+
+	case *ImportStatement:
+		path := *node.Path
+		return &ImportStatement{Token: node.Token, Path: &path, Name: copyIdentifier(node.Name)}
+
+	case *ExportStatement:
+		return &ExportStatement{Token: node.Token, Let: Copy(node.Let).(*LetStatement)}
+
+	case *Identifier:
+		return copyIdentifier(node)
+
+	case *IntegerLiteral:
+		copied := *node
+		return &copied
+
+	case *StringLiteral:
+		copied := *node
+		return &copied
+
+	case *BooleanLiteral:
+		copied := *node
+		return &copied
+
+	case *PrefixExpression:
+		return &PrefixExpression{Token: node.Token, Operator: node.Operator, Right: copyExpression(node.Right)}
+
+	case *InfixExpression:
+		return &InfixExpression{
+			Token:    node.Token,
+			Left:     copyExpression(node.Left),
+			Operator: node.Operator,
+			Right:    copyExpression(node.Right),
+		}
+
+	case *IndexExpression:
+		return &IndexExpression{Token: node.Token, Left: copyExpression(node.Left), Index: copyExpression(node.Index)}
+
+	case *MemberExpression:
+		return &MemberExpression{Token: node.Token, Object: copyExpression(node.Object), Member: copyIdentifier(node.Member)}
+
+	case *IfExpression:
+		return &IfExpression{
+			Token:       node.Token,
+			Condition:   copyExpression(node.Condition),
+			Consequence: copyBlock(node.Consequence),
+			Alternative: copyBlock(node.Alternative),
+		}
+
+	case *ForExpression:
+		return &ForExpression{
+			Token:    node.Token,
+			Variable: copyIdentifier(node.Variable),
+			Iterable: copyExpression(node.Iterable),
+			Body:     copyBlock(node.Body),
+		}
+
+	case *TryExpression:
+		return &TryExpression{
+			Token:     node.Token,
+			Block:     copyBlock(node.Block),
+			Parameter: copyIdentifier(node.Parameter),
+			Catch:     copyBlock(node.Catch),
+			Finally:   copyBlock(node.Finally),
+		}
+
+	case *FunctionLiteral:
+		return &FunctionLiteral{Token: node.Token, Parameters: copyIdentifiers(node.Parameters), Body: copyBlock(node.Body)}
+
+	case *MacroLiteral:
+		return &MacroLiteral{Token: node.Token, Parameters: copyIdentifiers(node.Parameters), Body: copyBlock(node.Body)}
+
+	case *CallExpression:
+		return &CallExpression{
+			Token:     node.Token,
+			Function:  copyExpression(node.Function),
+			Arguments: copyExpressions(node.Arguments),
+			Tail:      node.Tail,
+		}
+
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: node.Token, Elements: copyExpressions(node.Elements)}
+
+	case *SetLiteral:
+		return &SetLiteral{Token: node.Token, Elements: copyExpressions(node.Elements)}
+
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression, len(node.Pairs))
+		keys := make([]Expression, len(node.Keys))
+		for i, key := range node.Keys {
+			keys[i] = copyExpression(key)
+			pairs[keys[i]] = copyExpression(node.Pairs[key])
+		}
+		return &HashLiteral{Token: node.Token, Pairs: pairs, Keys: keys}
+
+	default:
+		panic(fmt.Sprintf("ast.Copy: unexpected node type %T", node))
+	}
+}
+
+func copyStatements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	copied := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		if stmt != nil {
+			copied[i] = Copy(stmt).(Statement)
+		}
+	}
+	return copied
+}
+
+func copyExpressions(exprs []Expression) []Expression {
+	if exprs == nil {
+		return nil
+	}
+	copied := make([]Expression, len(exprs))
+	for i, expr := range exprs {
+		copied[i] = copyExpression(expr)
+	}
+	return copied
+}
+
+func copyExpression(expr Expression) Expression {
+	if expr == nil {
+		return nil
+	}
+	return Copy(expr).(Expression)
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return &BlockStatement{Token: block.Token, Statements: copyStatements(block.Statements)}
+}
+
+func copyIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	copied := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		copied[i] = copyIdentifier(ident)
+	}
+	return copied
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	copied := *ident
+	return &copied
+}
@@ -0,0 +1,151 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk. If
+// the result w is not nil, Walk visits each of the children of node with w,
+// followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order. Children are visited in source
+// order.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+
+	case *ExpressionStatement:
+		walkIf(v, n.Expression)
+
+	case *LetStatement:
+		Walk(v, n.Name)
+		walkIf(v, n.Value)
+
+	case *ReturnStatement:
+		walkIf(v, n.ReturnValue)
+
+	case *ThrowStatement:
+		walkIf(v, n.Value)
+
+	case *ImportStatement:
+		Walk(v, n.Path)
+		Walk(v, n.Name)
+
+	case *ExportStatement:
+		Walk(v, n.Let)
+
+	case *Identifier, *IntegerLiteral, *StringLiteral, *BooleanLiteral:
+		// leaves :)
+
+	case *PrefixExpression:
+		Walk(v, n.Right)
+
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *IndexExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Index)
+
+	case *MemberExpression:
+		Walk(v, n.Object)
+		Walk(v, n.Member)
+
+	case *IfExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+
+	case *ForExpression:
+		Walk(v, n.Variable)
+		Walk(v, n.Iterable)
+		Walk(v, n.Body)
+
+	case *TryExpression:
+		Walk(v, n.Block)
+		if n.Catch != nil {
+			Walk(v, n.Parameter)
+			Walk(v, n.Catch)
+		}
+		if n.Finally != nil {
+			Walk(v, n.Finally)
+		}
+
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		Walk(v, n.Body)
+
+	case *MacroLiteral:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		Walk(v, n.Body)
+
+	case *CallExpression:
+		Walk(v, n.Function)
+		for _, arg := range n.Arguments {
+			Walk(v, arg)
+		}
+
+	case *ArrayLiteral:
+		for _, elem := range n.Elements {
+			Walk(v, elem)
+		}
+
+	case *SetLiteral:
+		for _, elem := range n.Elements {
+			Walk(v, elem)
+		}
+
+	case *HashLiteral:
+		for _, key := range n.Keys {
+			Walk(v, key)
+			Walk(v, n.Pairs[key])
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkIf(v Visitor, node Node) {
+	if node != nil {
+		Walk(v, node)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order, calling f(node) for each
+// node. If f returns true, Inspect invokes f recursively for each of the
+// children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,260 @@
+package ast
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"reflect"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	// let add = fn(x, y) { if (x < y) { return x; } else { y } };
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: &Identifier{Value: "add"},
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{{Value: "x"}, {Value: "y"}},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{
+								Expression: &IfExpression{
+									Condition: &InfixExpression{
+										Left:     &Identifier{Value: "x"},
+										Operator: "<",
+										Right:    &Identifier{Value: "y"},
+									},
+									Consequence: &BlockStatement{
+										Statements: []Statement{
+											&ReturnStatement{ReturnValue: &Identifier{Value: "x"}},
+										},
+									},
+									Alternative: &BlockStatement{
+										Statements: []Statement{
+											&ExpressionStatement{Expression: &Identifier{Value: "y"}},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	identifiers := []string{}
+	Inspect(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			identifiers = append(identifiers, ident.Value)
+		}
+		return true
+	})
+
+	expected := []string{"add", "x", "y", "x", "y", "x", "y"}
+	if !reflect.DeepEqual(identifiers, expected) {
+		t.Errorf("wrong identifiers. want=%v, got=%v", expected, identifiers)
+	}
+
+	visited := 0
+	Inspect(program, func(node Node) bool {
+		if node != nil {
+			visited++
+		}
+		_, isFunction := node.(*FunctionLiteral)
+		return !isFunction
+	})
+
+	if visited != 4 {
+		t.Errorf("pruned walk visited wrong number of nodes. want=4, got=%d", visited)
+	}
+}
+
+// TestWalkCoversAllNodeTypes fails when a node type is added to ast.go without
+// teaching Walk, Modify and Copy about it (and adding it to sampleNodes below).
+func TestWalkCoversAllNodeTypes(t *testing.T) {
+	samples := sampleNodes()
+
+	for _, name := range declaredNodeTypes(t) {
+		sample, ok := samples[name]
+		if !ok {
+			t.Errorf("no sample node for %s. add one to sampleNodes", name)
+			continue
+		}
+
+		t.Run(name, func(t *testing.T) {
+			expected := reflectChildren(sample)
+
+			visited := []Node{}
+			Walk(childRecorder{visited: &visited}, sample)
+			if !sameNodes(visited, expected) {
+				t.Errorf("Walk visited wrong children. want=%d nodes, got=%d", len(expected), len(visited))
+			}
+
+			modified := []Node{}
+			Modify(sample, func(node Node) Node {
+				modified = append(modified, node)
+				return node
+			})
+			if !sameNodes(modified, reflectDescendants(sample)) {
+				t.Errorf("Modify visited wrong nodes. got=%d", len(modified))
+			}
+
+			copied := Copy(sample)
+			original := append(reflectDescendants(sample), sample)
+			duplicate := append(reflectDescendants(copied), copied)
+			if len(duplicate) != len(original) {
+				t.Errorf("Copy has wrong number of nodes. want=%d, got=%d", len(original), len(duplicate))
+			}
+			for _, node := range duplicate {
+				for _, shared := range original {
+					if node == shared {
+						t.Errorf("Copy shares node %T with the original", node)
+					}
+				}
+			}
+		})
+	}
+}
+
+func sampleNodes() map[string]Node {
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	block := func(expr Expression) *BlockStatement {
+		return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: expr}}}
+	}
+	a, c := ident("a"), ident("c") // hash keys
+
+	return map[string]Node{
+		"Program":             &Program{Statements: []Statement{&ExpressionStatement{Expression: ident("a")}}},
+		"BlockStatement":      block(ident("a")),
+		"LetStatement":        &LetStatement{Name: ident("a"), Value: ident("b")},
+		"ReturnStatement":     &ReturnStatement{ReturnValue: ident("a")},
+		"ExpressionStatement": &ExpressionStatement{Expression: ident("a")},
+		"ThrowStatement":      &ThrowStatement{Value: ident("a")},
+		"ImportStatement":     &ImportStatement{Path: &StringLiteral{Value: "a.mk"}, Name: ident("a")},
+		"ExportStatement":     &ExportStatement{Let: &LetStatement{Name: ident("a"), Value: ident("b")}},
+		"Identifier":          ident("a"),
+		"IntegerLiteral":      &IntegerLiteral{Value: 1},
+		"StringLiteral":       &StringLiteral{Value: "a"},
+		"BooleanLiteral":      &BooleanLiteral{Value: true},
+		"ArrayLiteral":        &ArrayLiteral{Elements: []Expression{ident("a"), ident("b")}},
+		"SetLiteral":          &SetLiteral{Elements: []Expression{ident("a"), ident("b")}},
+		"IndexExpression":     &IndexExpression{Left: ident("a"), Index: ident("b")},
+		"MemberExpression":    &MemberExpression{Object: ident("a"), Member: ident("b")},
+		"PrefixExpression":    &PrefixExpression{Operator: "-", Right: ident("a")},
+		"HashLiteral":         &HashLiteral{Pairs: map[Expression]Expression{a: ident("b"), c: ident("d")}, Keys: []Expression{a, c}},
+		"InfixExpression":     &InfixExpression{Left: ident("a"), Operator: "+", Right: ident("b")},
+		"IfExpression":        &IfExpression{Condition: ident("a"), Consequence: block(ident("b")), Alternative: block(ident("c"))},
+		"ForExpression":       &ForExpression{Variable: ident("a"), Iterable: ident("b"), Body: block(ident("c"))},
+		"TryExpression":       &TryExpression{Block: block(ident("a")), Parameter: ident("e"), Catch: block(ident("b")), Finally: block(ident("c"))},
+		"FunctionLiteral":     &FunctionLiteral{Parameters: []*Identifier{ident("a"), ident("b")}, Body: block(ident("c"))},
+		"MacroLiteral":        &MacroLiteral{Parameters: []*Identifier{ident("a"), ident("b")}, Body: block(ident("c"))},
+		"CallExpression":      &CallExpression{Function: ident("f"), Arguments: []Expression{ident("a"), ident("b")}},
+	}
+}
+
+// declaredNodeTypes lists every type in this package with a TokenLiteral
+// method, i.e. every concrete Node.
+func declaredNodeTypes(t *testing.T) []string {
+	pkgs, err := goparser.ParseDir(gotoken.NewFileSet(), ".", nil, 0)
+	if err != nil {
+		t.Fatalf("could not parse package: %s", err)
+	}
+
+	names := []string{}
+	for _, file := range pkgs["ast"].Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Name.Name != "TokenLiteral" {
+				continue
+			}
+			if star, ok := fn.Recv.List[0].Type.(*goast.StarExpr); ok {
+				names = append(names, star.X.(*goast.Ident).Name)
+			}
+		}
+	}
+
+	return names
+}
+
+type childRecorder struct {
+	visited *[]Node
+	depth   int
+}
+
+func (r childRecorder) Visit(node Node) Visitor {
+	if node == nil {
+		return nil
+	}
+	if r.depth == 1 {
+		*r.visited = append(*r.visited, node)
+		return nil
+	}
+	return childRecorder{visited: r.visited, depth: r.depth + 1}
+}
+
+// reflectChildren finds the direct children of node by looking at every
+// field, so it can't fall out of date with the struct definitions.
+func reflectChildren(node Node) []Node {
+	nodeType := reflect.TypeOf((*Node)(nil)).Elem()
+	children := []Node{}
+	seen := map[Node]bool{} // HashLiteral keys are in both Pairs and Keys
+
+	add := func(v reflect.Value) {
+		if v.Type().Implements(nodeType) && !v.IsNil() && !seen[v.Interface().(Node)] {
+			seen[v.Interface().(Node)] = true
+			children = append(children, v.Interface().(Node))
+		}
+	}
+
+	value := reflect.ValueOf(node).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		switch field.Kind() {
+		case reflect.Slice:
+			for j := 0; j < field.Len(); j++ {
+				add(field.Index(j))
+			}
+		case reflect.Map:
+			iter := field.MapRange()
+			for iter.Next() {
+				add(iter.Key())
+				add(iter.Value())
+			}
+		case reflect.Interface, reflect.Pointer:
+			add(field)
+		}
+	}
+
+	return children
+}
+
+func reflectDescendants(node Node) []Node {
+	nodes := []Node{node}
+	for _, child := range reflectChildren(node) {
+		nodes = append(nodes, reflectDescendants(child)...)
+	}
+	return nodes
+}
+
+func sameNodes(got []Node, want []Node) bool {
+	if len(got) != len(want) {
+		return false
+	}
+
+	seen := make(map[Node]int)
+	for _, node := range want {
+		seen[node]++
+	}
+	for _, node := range got {
+		seen[node]--
+	}
+	for _, count := range seen {
+		if count != 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,128 +1,228 @@
 package eval
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"monkey/ast"
 	"monkey/object"
+	"strings"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
+func init() {
+	object.Apply = apply
+}
+
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalContext(context.Background(), node, env, Limits{})
+}
+
+// goCall stands in for the call site of functions called from Go.
+var goCall = &ast.CallExpression{Function: &ast.Identifier{Value: "<go>"}}
+
+// apply calls fn for Go code that got hold of it through object.ToGo, with
+// the caller of the environment it was made in if there is one.
+func apply(fn object.Object, args ...object.Object) object.Object {
+	builtins := object.Builtins
+	if fn, ok := fn.(*object.Function); ok {
+		if call := fn.Env.Caller(); call != nil {
+			return call(fn, args...)
+		}
+		builtins = fn.Env.Builtins()
+	}
+
+	return newEvaluator(Limits{}, builtins).applyFunction(goCall, fn, args)
+}
+
+func (e *evaluator) eval(node ast.Node, env *object.Environment) object.Object {
+	if err := e.step(); err != nil {
+		return err
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := e.eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := e.eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		bind(env, node.Name, val)
+
+	case *ast.ThrowStatement:
+		val := e.eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return throw(val)
+
+	case *ast.ImportStatement:
+		module := e.evalImportStatement(node, env)
+		if isError(module) {
+			return module
+		}
+		bind(env, node.Name, module)
+
+	case *ast.ExportStatement:
+		return e.eval(node.Let, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.eval(node.Expression, env)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return e.track(evalPrefixExpression(node.Operator, right))
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := e.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
+		right := e.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
-		return evalInfixExpression(left, node.Operator, right)
+		return e.track(e.evalInfixExpression(left, node.Operator, right))
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+
+	case *ast.ForExpression:
+		return e.evalForExpression(node, env)
+
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
 
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, expected=1", len(node.Arguments))
+			}
+			return e.quote(node.Arguments[0], env)
+		}
+
+		function, receiver := e.evalCallee(node.Function, env)
 		if isError(function) {
 			return function
 		}
 
-		args := evalExpressions(node.Arguments, env)
+		// error_trace takes the error its argument evaluates to, rather
+		// than letting the error end the program
+		if function == e.errorTrace && len(node.Arguments) == 1 {
+			arg := e.eval(node.Arguments[0], env)
+			if isFatal(arg) {
+				return arg
+			}
+			return e.applyFunction(node, function, []object.Object{arg})
+		}
+
+		args := e.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
+		if receiver != nil {
+			args = append([]object.Object{receiver}, args...)
+		}
+
+		if fn, ok := function.(*object.Function); ok && node.Tail {
+			return &tailCall{call: node, fn: fn, args: args}
+		}
 
-		return applyFunction(function, args)
+		return e.applyFunction(node, function, args)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return e.track(&object.Function{Parameters: params, Body: body, Env: env})
+
+	case *ast.MacroLiteral:
+		return newError(object.SYNTAX_ERROR, "macro literals are only allowed in top-level let statements")
 
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return e.track(&object.Integer{Value: node.Value})
 
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return e.track(&object.String{Value: node.Value})
 
 	case *ast.BooleanLiteral:
 		return boolConvert(node.Value)
 
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(node.Elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return e.track(object.NewArray(elements))
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		index := Eval(node.Index, env)
+		index := e.eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
 
 		return evalIndexExpression(left, index)
 
+	case *ast.MemberExpression:
+		obj := e.eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		return evalMemberExpression(obj, node.Member.Value)
+
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.track(e.evalHashLiteral(node, env))
+
+	case *ast.SetLiteral:
+		elements := e.evalExpressions(node.Elements, env)
+		if len(node.Elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return e.track(evalSetLiteral(elements))
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 	}
 
 	return nil
 }
 
 // evals
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (e *evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	if errors := resolveProgram(program, env, e.builtins); len(errors) > 0 {
+		return errors[0]
+	}
+
 	var result object.Object
 
 	for _, stmt := range program.Statements {
-		result = Eval(stmt, env)
+		result = e.eval(stmt, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -135,11 +235,11 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (e *evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, stmt := range block.Statements {
-		result = Eval(stmt, env)
+		result = e.eval(stmt, env)
 
 		if result != nil {
 			rt := result.Type()
@@ -152,24 +252,45 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	if val, ok := env.Get(node.Value); ok {
-		return val
-	}
+func (e *evaluator) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	switch node.Kind {
+	case ast.Variable:
+		if val, ok := env.GetAt(node.Depth, node.Slot); ok {
+			return val
+		}
+
+	case ast.Builtin:
+		return e.builtins[node.Slot].Builtin
 
-	if builtin, ok := builtins[node.Value]; ok {
-		return builtin
+	default:
+		// code that never went through Resolve is looked up by name
+		if val, ok := env.Get(node.Value); ok {
+			return val
+		}
+
+		if builtin := e.builtin(node.Value); builtin != nil {
+			return builtin
+		}
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError(object.NAME_ERROR, "identifier not found: "+node.Value)
+}
+
+// bind sets the variable ident declares in env.
+func bind(env *object.Environment, ident *ast.Identifier, val object.Object) {
+	if ident.Kind == ast.Variable {
+		env.SetAt(ident.Slot, val)
+	} else {
+		env.Set(ident.Value, val)
+	}
 }
 
 // function functions :)
-func evalExpressions(exprs []ast.Expression, env *object.Environment) []object.Object {
+func (e *evaluator) evalExpressions(exprs []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
 	for _, expr := range exprs {
-		evaluated := Eval(expr, env)
+		evaluated := e.eval(expr, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -179,26 +300,118 @@ func evalExpressions(exprs []ast.Expression, env *object.Environment) []object.O
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// evalCallee evaluates the function a call calls. For a method call, like
+// `xs.map(f)`, that's the method's builtin, and the value it's called on, xs,
+// is returned too, to be passed first.
+func (e *evaluator) evalCallee(node ast.Expression, env *object.Environment) (object.Object, object.Object) {
+	member, ok := node.(*ast.MemberExpression)
+	if !ok {
+		return e.eval(node, env), nil
+	}
+
+	obj := e.eval(member.Object, env)
+	if isError(obj) {
+		return obj, nil
+	}
+	if _, ok := obj.(*object.Module); ok {
+		return evalMemberExpression(obj, member.Member.Value), nil
+	}
+
+	method, ok := e.methods[obj.Type()][member.Member.Value]
+	if !ok {
+		return newError(object.NAME_ERROR, "%s has no method: %s", obj.Type(), member.Member.Value), nil
+	}
+	return method, obj
+}
+
+// tailCall stands in for the result of a call in tail position. The function
+// that made it returns straight away and applyFunction makes the call in its
+// place, so tail recursion runs in constant Go stack.
+type tailCall struct {
+	call *ast.CallExpression
+	fn   *object.Function
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// applyFunction calls fn with args. call is where the call was made, or a
+// stand-in for calls made from Go or by builtins.
+func (e *evaluator) applyFunction(call *ast.CallExpression, fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		result := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(result)
+		if err := e.pushFrame(newFrame(call, args)); err != nil {
+			return err
+		}
+		defer e.popFrame()
+
+		for {
+			if len(args) != len(fn.Parameters) {
+				err := newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, expected=%d", len(args), len(fn.Parameters))
+				e.addTrace(err)
+				return err
+			}
+
+			extendedEnv := extendFunctionEnv(fn, args)
+			result := unwrapReturnValue(e.evalScope(fn.Body, extendedEnv))
+
+			switch result := result.(type) {
+			case *tailCall:
+				fn, args = result.fn, result.args
+				e.frames[len(e.frames)-1] = newFrame(result.call, args)
+			case *object.Error:
+				e.addTrace(result)
+				return result
+			default:
+				return result
+			}
+		}
 
 	case *object.Builtin:
-		return fn.Fn(args...)
+		e.pinned = append(e.pinned, args...)
+		defer func() { e.pinned = e.pinned[:len(e.pinned)-len(args)] }()
+
+		if fn.Size != nil {
+			size := fn.Size(args...)
+			if err := e.reserve(size); err != nil {
+				return err
+			}
+			return e.trackSize(fn.Call(e.callback, args...), size)
+		}
+
+		if len(args) == 0 {
+			return e.track(fn.Call(e.callback, args...))
+		}
+
+		// builtins ending in ! change their first argument and hand it back,
+		// which only costs what it grew by
+		size := object.SizeOf(args[0])
+		result := fn.Call(e.callback, args...)
+		if result == args[0] {
+			return e.charge(result, object.SizeOf(result)-size)
+		}
+		return e.track(result)
 
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newError(object.TYPE_ERROR, "not a function: %s", fn.Type())
 	}
 }
 
+// callbackCall stands in for the call site of functions called by builtins.
+var callbackCall = &ast.CallExpression{Function: &ast.Identifier{Value: "<callback>"}}
+
+// callback is the Caller builtins like map are given, so the functions they
+// call run on e.
+func (e *evaluator) callback(fn object.Object, args ...object.Object) object.Object {
+	return e.applyFunction(callbackCall, fn, args)
+}
+
 func extendFunctionEnv(function *object.Function, args []object.Object) *object.Environment {
 	env := object.NewEnclosedEnvironment(function.Env)
 
 	for i, param := range function.Parameters {
-		env.Set(param.Value, args[i])
+		bind(env, param, args[i])
 	}
 
 	return env
@@ -220,7 +433,7 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -239,7 +452,7 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: -%s", right.Type())
 	}
 
 	value := right.(*object.Integer).Value
@@ -247,7 +460,13 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 }
 
 // infix evals
-func evalInfixExpression(left object.Object, operator string, right object.Object) object.Object {
+func (e *evaluator) evalInfixExpression(left object.Object, operator string, right object.Object) object.Object {
+	if operator == "in" {
+		return evalInExpression(left, right)
+	}
+	if operator == ">>" {
+		return evalComposeExpression(left, right)
+	}
 	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
 		return evalIntegerInfixExpression(left, operator, right)
 	}
@@ -257,7 +476,13 @@ func evalInfixExpression(left object.Object, operator string, right object.Objec
 	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
 		return evalStringInfixExpression(left, operator, right)
 	}
-	return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	if operator == "==" {
+		return boolConvert(object.Equal(left, right))
+	}
+	if operator == "!=" {
+		return boolConvert(!object.Equal(left, right))
+	}
+	return newError(object.TYPE_ERROR, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 }
 
 func evalIntegerInfixExpression(left object.Object, operator string, right object.Object) object.Object {
@@ -272,6 +497,9 @@ func evalIntegerInfixExpression(left object.Object, operator string, right objec
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError(object.VALUE_ERROR, "division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "==":
 		return boolConvert(leftVal == rightVal)
@@ -281,11 +509,76 @@ func evalIntegerInfixExpression(left object.Object, operator string, right objec
 		return boolConvert(leftVal < rightVal)
 	case ">":
 		return boolConvert(leftVal > rightVal)
+	case "..":
+		return &object.Range{Start: leftVal, End: rightVal}
+	case "..=":
+		// the end is kept exclusive, which the largest integer has no room for
+		if rightVal == math.MaxInt64 {
+			return newError(object.VALUE_ERROR, "inclusive range end out of bounds: %d", rightVal)
+		}
+		return &object.Range{Start: leftVal, End: rightVal + 1, Inclusive: true}
+	default:
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalInExpression(left object.Object, right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Range:
+		value, ok := left.(*object.Integer)
+		return boolConvert(ok && right.Contains(value.Value))
+
+	case *object.Array:
+		for _, elem := range right.Elements() {
+			if object.Equal(left, elem) {
+				return TRUE
+			}
+		}
+		return FALSE
+
+	case *object.Hash:
+		if _, ok := object.HashKeyOf(left); !ok {
+			return newError(object.TYPE_ERROR, "unusable type given as hash key: %s", left.Type())
+		}
+		_, ok := right.Get(left)
+		return boolConvert(ok)
+
+	case *object.Set:
+		if _, ok := object.HashKeyOf(left); !ok {
+			return newError(object.TYPE_ERROR, "unusable type given as set element: %s", left.Type())
+		}
+		return boolConvert(right.Contains(left))
+
+	case *object.ErrorValue:
+		name, ok := left.(*object.String)
+		if !ok {
+			return FALSE
+		}
+		_, ok = right.Field(name.Value)
+		return boolConvert(ok)
+
+	case *object.String:
+		substr, ok := left.(*object.String)
+		if !ok {
+			return newError(object.TYPE_ERROR, "type mismatch: %s in %s", left.Type(), right.Type())
+		}
+		return boolConvert(strings.Contains(right.Value, substr.Value))
+
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: %s in %s", left.Type(), right.Type())
 	}
 }
 
+// evalComposeExpression builds `f >> g`, a function that applies f to its
+// arguments and passes the result on to g.
+func evalComposeExpression(left object.Object, right object.Object) object.Object {
+	if !isCallable(left) || !isCallable(right) {
+		return newError(object.TYPE_ERROR, "type mismatch: %s >> %s", left.Type(), right.Type())
+	}
+
+	return object.Compose(left, right)
+}
+
 func evalStringInfixExpression(left object.Object, operator string, right object.Object) object.Object {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
@@ -298,7 +591,7 @@ func evalStringInfixExpression(left object.Object, operator string, right object
 	case "+":
 		return &object.String{Value: leftVal + rightVal}
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -312,34 +605,44 @@ func evalBooleanInfixExpression(left object.Object, operator string, right objec
 	case "!=":
 		return boolConvert(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
-func evalHashLiteral(hl *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+func (e *evaluator) evalHashLiteral(hl *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
 
-	for hlKey, hlValue := range hl.Pairs {
-		key := Eval(hlKey, env)
+	for _, hlKey := range hl.Keys {
+		key := e.eval(hlKey, env)
 		if isError(key) {
 			return key
 		}
 
-		hashable, ok := key.(object.Hashable)
-		if !ok {
-			return newError("unusable type given as hash key: %s", key.Type())
+		if _, ok := object.HashKeyOf(key); !ok {
+			return newError(object.TYPE_ERROR, "unusable type given as hash key: %s", key.Type())
 		}
 
-		value := Eval(hlValue, env)
+		value := e.eval(hl.Pairs[hlKey], env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashable.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(key, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
+}
+
+func evalSetLiteral(elements []object.Object) object.Object {
+	set := object.NewSet()
+
+	for _, elem := range elements {
+		if !set.Add(elem) {
+			return newError(object.TYPE_ERROR, "unusable type given as set element: %s", elem.Type())
+		}
+	}
+
+	return set
 }
 
 func evalIndexExpression(left object.Object, index object.Object) object.Object {
@@ -347,54 +650,174 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 		return evalArrayIndexExpression(left, index)
 	}
 
+	if left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ {
+		return evalRangeIndexExpression(left, index)
+	}
+
 	if left.Type() == object.HASH_OBJ {
 		return evalHashIndexExpression(left, index)
 	}
 
-	return newError("index operator not supported for type: %s", left.Type())
+	if left.Type() == object.ERROR_VALUE_OBJ && index.Type() == object.STRING_OBJ {
+		if field, ok := left.(*object.ErrorValue).Field(index.(*object.String).Value); ok {
+			return field
+		}
+		return NULL
+	}
+
+	return newError(object.TYPE_ERROR, "index operator not supported for type: %s", left.Type())
 }
 
 func evalArrayIndexExpression(array object.Object, index object.Object) object.Object {
 	arrayObj := array.(*object.Array)
 	indexVal := index.(*object.Integer).Value
 
-	if indexVal < 0 || indexVal > int64(len(arrayObj.Elements)-1) {
+	if indexVal < 0 || indexVal > int64(arrayObj.Len()-1) {
 		return NULL
 	}
 
-	return arrayObj.Elements[indexVal]
+	elem, _ := arrayObj.At(int(indexVal))
+	return elem
+}
+
+func evalRangeIndexExpression(rng object.Object, index object.Object) object.Object {
+	rangeObj := rng.(*object.Range)
+	indexVal := index.(*object.Integer).Value
+
+	value, ok := rangeObj.At(indexVal)
+	if !ok {
+		return NULL
+	}
+
+	return &object.Integer{Value: value}
 }
 
 func evalHashIndexExpression(hash object.Object, index object.Object) object.Object {
 	hashObj := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return newError("unusable type given as hash key: %s", index.Type())
+	if _, ok := object.HashKeyOf(index); !ok {
+		return newError(object.TYPE_ERROR, "unusable type given as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObj.Pairs[key.HashKey()]
+	value, ok := hashObj.Get(index)
 	if !ok {
 		return NULL
 	}
 
-	return pair.Value
+	return value
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (e *evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
+func (e *evaluator) evalForExpression(fe *ast.ForExpression, env *object.Environment) object.Object {
+	iterable := e.eval(fe.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	result := iterate(iterable, func(elem object.Object) object.Object {
+		loopEnv := object.NewEnclosedEnvironment(env)
+		bind(loopEnv, fe.Variable, elem)
+
+		result := e.evalScope(fe.Body, loopEnv)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+		return nil
+	})
+	if result != nil {
+		return result
+	}
+
+	return NULL
+}
+
+// evalTryExpression runs the try block, handing any error it ends in to the
+// catch block. Errors that stop evaluation from outside, such as running over
+// a budget, can't be caught, and skip the finally block too.
+func (e *evaluator) evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := e.eval(te.Block, env)
+
+	if err, ok := result.(*object.Error); ok && err.Fatal == nil && te.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		bind(catchEnv, te.Parameter, &object.ErrorValue{Error: err})
+		result = e.evalScope(te.Catch, catchEnv)
+	}
+
+	if te.Finally != nil && !isFatal(result) {
+		// finally's result is dropped, unless it returns or fails
+		final := e.eval(te.Finally, env)
+		if final != nil {
+			rt := final.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return final
+			}
+		}
+	}
+
+	return result
+}
+
+// throw turns val into the error it raises. Caught errors are raised again
+// as they were; strings become the message of a plain error, and hashes give
+// their "message" and "kind".
+func throw(val object.Object) *object.Error {
+	switch val := val.(type) {
+	case *object.ErrorValue:
+		err := *val.Error
+		err.Trace = append([]object.Frame{}, err.Trace...)
+		return &err
+
+	case *object.String:
+		return &object.Error{Kind: object.DefaultErrorKind, Message: val.Value}
+
+	case *object.Hash:
+		err := &object.Error{Kind: object.DefaultErrorKind, Message: val.Inspect()}
+		if message, ok := val.Get(&object.String{Value: "message"}); ok {
+			err.Message = message.Inspect()
+		}
+		if kind, ok := val.Get(&object.String{Value: "kind"}); ok {
+			err.Kind = kind.Inspect()
+		}
+		return err
+
+	default:
+		return &object.Error{Kind: object.DefaultErrorKind, Message: val.Inspect()}
+	}
+}
+
+// iterate calls fn with each element of iterable in order. Iteration stops at
+// the first non-nil result from fn, which is handed back to the caller.
+func iterate(iterable object.Object, fn func(object.Object) object.Object) object.Object {
+	iter, ok := object.NewIterator(iterable)
+	if !ok {
+		return newError(object.TYPE_ERROR, "cannot iterate over %s", iterable.Type())
+	}
+
+	for elem, ok := iter.Next(); ok; elem, ok = iter.Next() {
+		if result := fn(elem); result != nil {
+			return result
+		}
+	}
+
+	return nil
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -409,8 +832,8 @@ func isTruthy(obj object.Object) bool {
 }
 
 // helper stuff :)
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newError(kind string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
 }
 
 func isError(obj object.Object) bool {
@@ -420,6 +843,15 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin:
+		return true
+	default:
+		return false
+	}
+}
+
 func boolConvert(value bool) *object.Boolean {
 	if value {
 		return TRUE
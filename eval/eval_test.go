@@ -1,10 +1,15 @@
 package eval
 
 import (
+	"context"
+	"errors"
+	"monkey/compiler"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/vm"
 	"testing"
+	"time"
 )
 
 // expressions :)
@@ -91,6 +96,24 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 > 2) == false", true},
 		{`"Hello" == "World!"`, false},
 		{`"Hello" != "World!"`, true},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, [2, [3]]] == [1, [2, [3]]]", true},
+		{"[1, [2, [3]]] == [1, [2, [4]]]", false},
+		{"[] == []", true},
+		{"[1] == [1, 1]", false},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{"a": 1} != {"a": 1, "b": 2}`, true},
+		{"{} == {}", true},
+		{"1..3 == 1..3", true},
+		{`1 == "1"`, false},
+		{`1 != "1"`, true},
+		{"[1] == {}", false},
+		{"true == 1", false},
+		{"[1, 2] == 1..3", false},
 	}
 
 	for _, tt := range tests {
@@ -134,13 +157,13 @@ func TestArrayLiterals(t *testing.T) {
 		t.Fatalf("object is not Array. got=%T (%+v)", result, result)
 	}
 
-	if len(arr.Elements) != 3 {
-		t.Fatalf("array has wrong number of elements. got=%d, expected=3", len(arr.Elements))
+	if arr.Len() != 3 {
+		t.Fatalf("array has wrong number of elements. got=%d, expected=3", arr.Len())
 	}
 
-	testIntegerObject(t, arr.Elements[0], 1)
-	testIntegerObject(t, arr.Elements[1], 4)
-	testIntegerObject(t, arr.Elements[2], 6)
+	testIntegerObject(t, arr.Elements()[0], 1)
+	testIntegerObject(t, arr.Elements()[1], 4)
+	testIntegerObject(t, arr.Elements()[2], 6)
 }
 
 func TestArrayIndexExpressions(t *testing.T) {
@@ -215,13 +238,13 @@ func TestHashLiterals(t *testing.T) {
 		true: 5,
 		false: 6
 	}`
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():      4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
+	expected := map[object.Object]int64{
+		&object.String{Value: "one"}:   1,
+		&object.String{Value: "two"}:   2,
+		&object.String{Value: "three"}: 3,
+		&object.Integer{Value: 4}:      4,
+		TRUE:                           5,
+		FALSE:                          6,
 	}
 
 	result := testEval(input)
@@ -230,17 +253,174 @@ func TestHashLiterals(t *testing.T) {
 		t.Fatalf("object is not Hash. got=%T (%+v)", result, result)
 	}
 
-	if len(hash.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d, expected=6", len(hash.Pairs))
+	if hash.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d, expected=6", hash.Len())
 	}
 
 	for expectedKey, expectedValue := range expected {
-		pair, ok := hash.Pairs[expectedKey]
+		value, ok := hash.Get(expectedKey)
 		if !ok {
 			t.Errorf("no pair found for given key")
 		}
 
-		testIntegerObject(t, pair.Value, expectedValue)
+		testIntegerObject(t, value, expectedValue)
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, "c": 3}`, "{b: 1, a: 2, c: 3}"},
+		{`{3: 1, 1: 2, 2: 3, 1: 4}`, "{3: 1, 1: 4, 2: 3}"},
+		{`{"z": {"y": 1, "x": 2}, "w": [{"v": 1, "u": 2}]}`, "{z: {y: 1, x: 2}, w: [{v: 1, u: 2}]}"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if result.Inspect() != tt.expected {
+			t.Errorf("wrong order for %q. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestSetLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`#{3, 1, 2}`, "#{3, 1, 2}"},
+		{`#{1, 2, 1, 3, 2}`, "#{1, 2, 3}"},
+		{`#{}`, "#{}"},
+		{`#{"a", [1, 2], [1, 2], {"k": 1}}`, "#{a, [1, 2], {k: 1}}"},
+		{`len(#{1, 1, 2})`, 2},
+		{`2 in #{1, 2, 3}`, true},
+		{`4 in #{1, 2, 3}`, false},
+		{`[1] in #{[1], [2]}`, true},
+		{`"1" in #{1}`, false},
+		{`#{1, 2} == #{2, 1}`, true},
+		{`#{1, 2} == #{1, 2, 3}`, false},
+		{`#{1, 2} == [1, 2]`, false},
+		{`{#{1, 2}: "x"}[#{2, 1}]`, "x"},
+		{`union(#{1, 2}, #{2, 3})`, "#{1, 2, 3}"},
+		{`intersection(#{1, 2, 3}, #{3, 2, 4})`, "#{2, 3}"},
+		{`difference(#{1, 2, 3}, #{2})`, "#{1, 3}"},
+		{`union(#{}, #{})`, "#{}"},
+		{`let f = fn(s) { for (x in s) { if (x > 1) { return x } } }; f(#{1, 5, 2})`, 5},
+		{`#{fn(x) { x }}`, "unusable type given as set element: FUNCTION"},
+		{`fn(x) { x } in #{1}`, "unusable type given as set element: FUNCTION"},
+		{`union(#{1}, [2])`, "second argument to `union` must be SET, got=ARRAY"},
+		{`difference(1, #{2})`, "first argument to `difference` must be SET, got=INTEGER"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, result, int64(expected))
+		case bool:
+			testBooleanObject(t, result, expected)
+		case string:
+			if errObj, ok := result.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message for %q. want=%q, got=%q", tt.input, expected, errObj.Message)
+				}
+			} else if result.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, expected, result.Inspect())
+			}
+		}
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"abc".upper()`, "ABC"},
+		{`"ABC".lower().len()`, "3"},
+		{`[1, 2, 3, 4].map(fn(x) { x * 10 }).filter(fn(x) { x > 15 })`, "[20, 30, 40]"},
+		{`{"b": 2, "a": 1}.keys()`, "[b, a]"},
+		{`let xs = [1]; xs.append!(2); xs.push(3).rest()`, "[2, 3]"},
+		{`#{1, 2}.union(#{3})`, "#{1, 2, 3}"},
+		{`(0..4).len()`, "4"},
+		{`["a", "b"].map(upper)`, "[A, B]"},
+		{`let upper = fn(s) { s }; "abc".upper()`, "ABC"},
+		{`[1, 2].map(fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`"abc".keys()`, "STRING has no method: keys"},
+		{`1.upper()`, "INTEGER has no method: upper"},
+		{`"abc".upper(1)`, "wrong number of arguments. got=2, expected=1"},
+		{`nope.upper()`, "identifier not found: nope"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+
+		got := result.Inspect()
+		if errObj, ok := result.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMutatingBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let xs = [1]; append!(xs, 2); xs`, "[1, 2]"},
+		{`let xs = []; for (i in 0..10000) { append!(xs, i) }; len(xs)`, "10000"},
+		{`let xs = [1, 2, 3]; set!(xs, 0, "one"); xs`, "[one, 2, 3]"},
+		{`let xs = [1, 2, 3]; let last = pop!(xs); [last, xs]`, "[3, [1, 2]]"},
+		{`pop!([])`, "null"},
+		{`let h = {"a": 1}; set!(h, "b", 2); set!(h, "a", 3); h`, "{a: 3, b: 2}"},
+		{`let h = {"a": 1, "b": 2}; delete!(h, "a"); delete!(h, "c"); h`, "{b: 2}"},
+		{`set!({}, "a", 1) == {"a": 1}`, "true"},
+
+		// push and friends still make new arrays
+		{`let xs = [1]; let ys = push(xs, 2); append!(ys, 3); [xs, ys]`, "[[1], [1, 2, 3]]"},
+		{`let xs = [1, 2, 3]; let ys = set(xs, 0, "one"); [xs, ys]`, "[[1, 2, 3], [one, 2, 3]]"},
+		{`let h = {"a": 1}; let g = h.set("b", 2); let f = delete(g, "a"); [h, g, f]`, "[{a: 1}, {a: 1, b: 2}, {b: 2}]"},
+
+		// rest shares its argument's elements, but appending to either doesn't
+		// show in the other
+		{`let xs = [1, 2, 3]; let ys = rest(xs); set!(ys, 0, "two"); [xs, ys]`, "[[1, 2, 3], [two, 3]]"},
+		{`let xs = [1, 2]; let ys = push(xs, 3); append!(xs, 4); [xs, ys]`, "[[1, 2, 4], [1, 2, 3]]"},
+		{`let xs = [1, 2, 3]; let ys = rest(xs); append!(ys, 4); append!(xs, 5); [xs, ys]`, "[[1, 2, 3, 5], [2, 3, 4]]"},
+
+		// keys are copied, values aren't
+		{`let k = [1]; let h = {k: "one"}; append!(k, 2); [h[[1]], h[k]]`, "[one, null]"},
+		{`let v = [1]; let h = {"v": v}; append!(v, 2); h`, "{v: [1, 2]}"},
+		{`let k = [1]; let s = #{k}; append!(k, 2); [1] in s`, "true"},
+
+		{`let h = {}; set!(h, "self", h); h`, "{self: {...}}"},
+		{`let xs = [1]; append!(xs, xs); [xs, xs == xs]`, "[[1, [...]], true]"},
+
+		{`append!(1, 2)`, "argument type given to `append!` not supported, got=INTEGER"},
+		{`set!([1], 1, 2)`, "index out of range: 1"},
+		{`set!([1], "0", 2)`, "index given to `set!` must be INTEGER, got=STRING"},
+		{`set!({}, fn(x) { x }, 2)`, "unusable type given as hash key: FUNCTION"},
+		{`delete!([1], 0)`, "argument type given to `delete!` not supported, got=ARRAY"},
+		{`set([1], 1, 2)`, "index out of range: 1"},
+		{`delete([1], 0)`, "argument type given to `delete` not supported, got=ARRAY"},
+		{`pop!([1], 2)`, "wrong number of arguments. got=2, expected=1"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+
+		got := result.Inspect()
+		if errObj, ok := result.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
 	}
 }
 
@@ -257,6 +437,18 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{"foo": 5}["bar"]`,
 			nil,
 		},
+		{
+			`{[1, "a"]: 5}[[1, "a"]]`,
+			5,
+		},
+		{
+			`{[1, "a"]: 5}[["a", 1]]`,
+			nil,
+		},
+		{
+			`{{"x": 1, "y": 2}: 5}[{"y": 2, "x": 1}]`,
+			5,
+		},
 		{
 			`let key = "foo"; {"foo": 5}[key]`,
 			5,
@@ -291,6 +483,129 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestRangeExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"len(0..10)", 10},
+		{"len(0..=10)", 11},
+		{"len(5..1)", 0},
+		{"(2..5)[0]", 2},
+		{"(2..5)[2]", 4},
+		{"(2..5)[3]", nil},
+		{"(2..5)[-1]", nil},
+		{"len(0..1000000000)", 1000000000},
+		{"(0..1000000000)[999999999]", 999999999},
+		{"let n = 3; len(0..n + 1)", 4},
+		{"len(9223372036854775806..=9223372036854775806)", 1},
+		{"0..=9223372036854775807", "inclusive range end out of bounds: 9223372036854775807"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, result, int64(expected))
+		case string:
+			errObj, ok := result.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("wrong result for %q. want error %q, got=%s", tt.input, expected, result.Inspect())
+			}
+		default:
+			testNullObject(t, result)
+		}
+	}
+}
+
+func TestRangeInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1..3", "1..3"},
+		{"1..=3", "1..=3"},
+		{"5..1", "5..1"},
+		{"3..=2", "3..=2"},
+		{"-2..=-1", "-2..=-1"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if _, ok := result.(*object.Range); !ok || result.Inspect() != tt.expected {
+			t.Errorf("wrong range for %q. want=%q, got=%s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestInExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"3 in 0..5", true},
+		{"5 in 0..5", false},
+		{"5 in 0..=5", true},
+		{"-1 in 0..5", false},
+		{`"a" in 0..5`, false},
+		{"2 in [1, 2, 3]", true},
+		{"4 in [1, 2, 3]", false},
+		{`"b" in ["a", "b"]`, true},
+		{`"foo" in {"foo": 1}`, true},
+		{`"bar" in {"foo": 1}`, false},
+		{`"ell" in "hello"`, true},
+		{`"xyz" in "hello"`, false},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestForExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn() { for (i in 0..10) { if (i == 4) { return i } } }; f()", 4},
+		{"let f = fn(xs) { for (x in xs) { if (x > 2) { return x } } }; f([1, 2, 3, 4])", 3},
+		{"for (i in 0..3) { i }", nil},
+		{"for (i in []) { i }", nil},
+		{"let f = fn() { for (i in 0..=100000) { if (i == 100000) { return i } } }; f()", 100000},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		expected, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, result, int64(expected))
+		} else {
+			testNullObject(t, result)
+		}
+	}
+}
+
+func TestPipeAndComposeExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let double = fn(x) { x * 2 }; 5 |> double", 10},
+		{"let add = fn(x, y) { x + y }; 5 |> add(3)", 8},
+		{"let adder = fn(x) { fn(y) { x + y } }; 5 |> (adder(3))", 8},
+		{"let add = fn(x, y) { x + y }; let double = fn(x) { x * 2 }; 1 |> add(2) |> double", 6},
+		{"[1, 2, 3] |> len", 3},
+		{"let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; (inc >> double)(3)", 8},
+		{"let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; 3 |> double >> inc", 7},
+		{"let add = fn(x, y) { x + y }; let double = fn(x) { x * 2 }; (add >> double)(1, 2)", 6},
+		{"(rest >> len)([1, 2, 3])", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 // statements :)
 func TestReturnStatement(t *testing.T) {
 	tests := []struct {
@@ -367,6 +682,24 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestArrowFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let double = x => x * 2; double(5);", 10},
+		{"let add = (x, y) => x + y; add(5, 5);", 10},
+		{"let five = () => 5; five();", 5},
+		{"let adder = x => y => x + y; adder(2)(3);", 5},
+		{"let apply = fn(f, x) { f(x) }; apply((x) => x - 1, 5);", 4},
+		{"5 |> (x => x * 3)", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 		let newAdder = fn(x) {
@@ -378,6 +711,541 @@ func TestClosures(t *testing.T) {
 	testIntegerObject(t, testEval(input), 4)
 }
 
+func TestScopeResolution(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 5; let f = fn() { let x = 10; x }; f() + x", 15},
+		{"let f = fn(x) { let x = x + 1; x }; f(1)", 2},
+		{"let f = fn() { g() }; let g = fn() { 3 }; f()", 3},
+		{
+			`
+			let f = fn(n) {
+				let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+				let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+				isEven(n)
+			};
+			f(10)
+			`,
+			true,
+		},
+		{"let len = fn(x) { 42 }; len([1])", 42},
+		{"let f = fn() { len([1, 2]) }; f()", 2},
+		{"let total = 0; for (i in 0..3) { let total = i }; total", 0},
+		{"f(); let f = fn() { 1 }", "identifier not found: f"},
+		{"if (false) { foobar }", "identifier not found: foobar"},
+		{"let f = fn() { let g = fn() { missing }; 1 }; f()", "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(100000, 0)", 5000050000},
+		{"let count = fn(n) { if (n == 0) { return 0; } return count(n - 1); }; count(100000)", 0},
+		{
+			`
+			let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+			let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+			if (isEven(100000)) { 1 } else { 0 }
+			`,
+			1,
+		},
+		{"let loop = fn(xs, acc) { for (x in xs) { return loop(rest(xs), acc + x) }; acc }; loop(array(1..=1000), 0)", 500500},
+		{"let f = fn(n) { n * 2 }; let g = fn(n) { f(n) + 1 }; g(5)", 11},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestCallDepth(t *testing.T) {
+	depth := "let depth = fn(n) { if (n == 0) { 0 } else { 1 + depth(n - 1) } };"
+
+	testIntegerObject(t, testEval(depth+"depth(9000)"), 9000)
+
+	evaluated := testEval(depth + "depth(1000000)")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	expected := "stack overflow: maximum call depth of 10000 exceeded in depth, depth, depth, depth, depth, ... 9995 more"
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		limit    int
+		expected string
+	}{
+		{
+			"let f = fn() { 1 + g() }; let g = fn() { 1 + f() }; f()",
+			3,
+			"stack overflow: maximum call depth of 3 exceeded in f, g, f",
+		},
+		{
+			"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(2)",
+			3,
+			"",
+		},
+		{
+			"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(100)",
+			1,
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		evaluated := EvalWithLimits(program, object.NewEnvironment(), Limits{MaxCallDepth: tt.limit})
+		errObj, isErr := evaluated.(*object.Error)
+
+		if tt.expected == "" {
+			if isErr {
+				t.Errorf("unexpected error: %s", errObj.Message)
+			}
+			continue
+		}
+
+		if !isErr {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestErrorTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			`let inner = fn(x) { x + true };
+let outer = fn(a, b) { inner(a) * b };
+outer(1, "two")`,
+			[]string{
+				"inner(1) (line 2, column 29)",
+				`outer(1, "two") (line 3, column 6)`,
+			},
+		},
+		{
+			"let f = fn(xs) { len(xs, xs) }; f([1, 2, 3, 4, 5, 6, 7, 8, 9])",
+			[]string{"f([1, 2, 3, 4, 5, 6...) (line 1, column 34)"},
+		},
+		{
+			`let f = fn(s) { len(s, s) }; f("éééééééééééééééééééé")`,
+			[]string{`f("éééééééééééééééé...) (line 1, column 31)`},
+		},
+		{
+			"let loop = fn(n) { if (n == 0) { n + true } else { loop(n - 1) } }; loop(3)",
+			[]string{"loop(0) (line 1, column 56)"},
+		},
+		{
+			"let f = fn(x) { x + true }; (f >> f)(1)",
+			[]string{"<callback>(1)"},
+		},
+		{
+			"5 + true",
+			[]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if len(errObj.Trace) != len(tt.expected) {
+			t.Errorf("wrong number of frames. want=%d, got=%d (%v)", len(tt.expected), len(errObj.Trace), errObj.Trace)
+			continue
+		}
+		for i, frame := range tt.expected {
+			if errObj.Trace[i].String() != frame {
+				t.Errorf("frame %d wrong. want=%q, got=%q", i, frame, errObj.Trace[i].String())
+			}
+		}
+	}
+}
+
+func TestErrorTraceBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			"let f = fn(x) { x + true }; let g = fn(x) { f(x) * 2 }; error_trace(g(1))",
+			[]string{"f(1) (line 1, column 46)", "g(1) (line 1, column 70)"},
+		},
+		{"error_trace(5 + true)", []string{}},
+		{"error_trace(5)", "argument to `error_trace` must be ERROR, got=INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case []string:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if array.Len() != len(expected) {
+				t.Errorf("wrong number of frames. want=%d, got=%d", len(expected), array.Len())
+				continue
+			}
+			for i, frame := range expected {
+				str, ok := array.Elements()[i].(*object.String)
+				if !ok || str.Value != frame {
+					t.Errorf("frame %d wrong. want=%q, got=%+v", i, frame, array.Elements()[i])
+				}
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { 1 + true } catch (e) { 2 }`, 2},
+		{`try { 1 + true; 3 } catch (e) { e["message"] }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`try { throw "oops" } catch (e) { e["message"] }`, "oops"},
+		{`try { throw "oops" } catch (e) { e["kind"] }`, "Error"},
+		{`try { throw {"message": "bad id", "kind": "ValueError"} } catch (e) { e["kind"] + ": " + e["message"] }`, "ValueError: bad id"},
+		{`try { throw 42 } catch (e) { e["message"] }`, "42"},
+		{`try { throw "oops" } catch (e) { e["nope"] }`, nil},
+		{`let f = fn() { throw "deep" }; let g = fn() { let r = f(); r }; try { g() } catch (e) { e["trace"] }`, []string{"f() (line 1, column 56)", "g() (line 1, column 72)"}},
+		{`let f = fn() { throw "deep" }; try { f() } catch (e) { error_trace(e) }`, []string{"f() (line 1, column 39)"}},
+		{`try { throw "inner" } catch (e) { try { throw e } catch (again) { again["message"] } }`, "inner"},
+		{`try { throw "first" } catch (e) { throw "second" }`, "second"},
+		{`throw "uncaught"`, "uncaught"},
+		{`let r = try { 1 } finally { 2 }; r`, 1},
+		{`let f = fn() { try { return 1; } finally { 2 } }; f()`, 1},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f()`, 2},
+		{`try { 1 } finally { 1 + true }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`try { 1 + true } finally { 2 }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`let e = 1; try { throw "x" } catch (e) { 2 }; e`, 1},
+		{`try { throw "x" } catch (e) { let y = 5; y }`, 5},
+		{`let f = fn(n) { try { if (n == 0) { throw "done" } else { f(n - 1) } } catch (e) { n } }; f(3)`, 0},
+		{`let f = fn() { 1 + f() }; try { f() } catch (e) { e["kind"] }`, "RecursionError"},
+		{`try { throw "oops" } catch (e) { e.message }`, "oops"},
+		{`try { throw {"message": "bad id", "kind": "ValueError"} } catch (e) { e.kind }`, "ValueError"},
+		{`try { 1 / 0 } catch (e) { e.cause }`, nil},
+		{`try { try { 1 / 0 } catch (e) { throw error("ValueError", "failed", e) } } catch (e) { e.cause.message }`, "division by zero"},
+		{`try { throw "oops" } catch (e) { e.nope }`, "ERROR_VALUE has no field: nope"},
+		{`try { throw "oops" } catch (e) { keys(e) }`, []string{"kind", "message", "trace", "cause"}},
+		{`try { throw "oops" } catch (e) { e.keys() }`, []string{"kind", "message", "trace", "cause"}},
+		{`try { throw "oops" } catch (e) { "kind" in e }`, true},
+		{`try { throw "oops" } catch (e) { "nope" in e }`, false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("wrong string for %q. want=%q, got=%q", tt.input, expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, expected, obj.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		case []string:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if array.Len() != len(expected) {
+				t.Errorf("wrong number of frames. want=%d, got=%d", len(expected), array.Len())
+				continue
+			}
+			for i, frame := range expected {
+				if array.Elements()[i].Inspect() != frame {
+					t.Errorf("frame %d wrong. want=%q, got=%q", i, frame, array.Elements()[i].Inspect())
+				}
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestErrorValueFields(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`error("ValueError", "bad id")["kind"]`, "ValueError"},
+		{`error("ValueError", "bad id")["nope"]`, nil},
+		{`keys(error("ValueError", "bad id"))`, []string{"kind", "message", "trace", "cause"}},
+		{`values(error("ValueError", "bad id"))`, []string{"ValueError", "bad id", "[]", "null"}},
+		{`"message" in error("ValueError", "bad id")`, true},
+		{`"nope" in error("ValueError", "bad id")`, false},
+		{`1 in error("ValueError", "bad id")`, false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("wrong result for %q. want=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		case []string:
+			array, ok := evaluated.(*object.Array)
+			if !ok || array.Len() != len(expected) {
+				t.Errorf("wrong result for %q. want=%q, got=%+v", tt.input, expected, evaluated)
+				continue
+			}
+			for i, want := range expected {
+				if got := array.Elements()[i].Inspect(); got != want {
+					t.Errorf("element %d wrong for %q. want=%q, got=%q", i, tt.input, want, got)
+				}
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 + true`, "TypeError"},
+		{`-true`, "TypeError"},
+		{`"a" - "b"`, "TypeError"},
+		{`1(2)`, "TypeError"},
+		{`{[fn(x) { x }]: 2}`, "TypeError"},
+		{`5[0]`, "TypeError"},
+		{`for (x in 5) { x }`, "TypeError"},
+		{`len(1)`, "TypeError"},
+		{`1 / 0`, "ValueError"},
+		{`fn(x) { x }()`, "ArityError"},
+		{`len()`, "ArityError"},
+		{`quote(1, 2)`, "ArityError"},
+		{`let m = macro(x) { x }; fn() { macro(y) { y } }()`, "SyntaxError"},
+		{`let f = fn() { 1 + f() }; f()`, "RecursionError"},
+		{`throw "plain"`, "Error"},
+		{`throw error("ValueError", "bad id")`, "ValueError"},
+		{`throw error("MyError", "custom")`, "MyError"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvaluate("try { " + tt.input + " } catch (e) { e[\"kind\"] }")
+
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("wrong kind for %q. want=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	// unbound names are caught before anything runs, so there's no catching them
+	err, ok := testEvaluate(`let f = fn() { undefined }; f()`).(*object.Error)
+	if !ok || err.Kind != object.NAME_ERROR {
+		t.Errorf("wrong error for unbound name. got=%+v", err)
+	}
+}
+
+func TestErrorValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`error("ValueError", "bad id")`, "ValueError: bad id"},
+		{`error("ValueError", "bad id")["message"]`, "bad id"},
+		{`is_error(error("ValueError", "bad id"))`, true},
+		{`is_error("bad id")`, false},
+		{`is_error(error("ValueError", "bad id"), "ValueError")`, true},
+		{`is_error(error("ValueError", "bad id"), "TypeError")`, false},
+		{`is_error(1, "TypeError")`, false},
+		{`let cause = error("NameError", "no user"); is_error(error("ValueError", "lookup failed", cause), "NameError")`, true},
+		{`let cause = error("NameError", "no user"); unwrap(error("ValueError", "lookup failed", cause))["message"]`, "no user"},
+		{`let cause = error("NameError", "no user"); error("ValueError", "lookup failed", cause)["cause"]["kind"]`, "NameError"},
+		{`unwrap(error("ValueError", "bad id"))`, nil},
+		{`try { try { 1 / 0 } catch (e) { throw error("ValueError", "average failed", e) } } catch (e) { unwrap(e)["message"] }`, "division by zero"},
+		{`try { 1 + true } catch (e) { is_error(e, "TypeError") }`, true},
+		{`error("ValueError")`, "wrong number of arguments. got=1, expected=2 or 3"},
+		{`error(1, "bad id")`, "first argument to `error` must be STRING, got=INTEGER"},
+		{`error("ValueError", "bad id", 3)`, "third argument to `error` must be ERROR_VALUE, got=INTEGER"},
+		{`unwrap(1)`, "argument to `unwrap` must be ERROR_VALUE, got=INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvaluate(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if evaluated == nil || (evaluated.Inspect() != expected && evaluated.Inspect() != "ERROR: "+expected) {
+				t.Errorf("wrong result for %q. want=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input    string
+		ctx      context.Context
+		limits   Limits
+		expected error
+	}{
+		{"let f = fn() { f() }; f()", context.Background(), Limits{Timeout: 20 * time.Millisecond}, ErrTimeout},
+		{"for (i in 0..1000000000) { i }", cancelled, Limits{}, ErrCancelled},
+		{"let f = fn(n) { f(n + 1) }; f(0)", context.Background(), Limits{MaxSteps: 1000}, ErrStepLimit},
+		{"let f = fn(n) { error_trace(f(n + 1)) }; f(0)", context.Background(), Limits{MaxSteps: 1000}, ErrStepLimit},
+		{"for (i in 0..1000000000) { [i] }", context.Background(), Limits{MaxAllocations: 100}, ErrAllocationLimit},
+		{"let xss = []; for (i in 0..10000) { append!(xss, array(0..100)) }", context.Background(), Limits{MaxBytes: 1 << 20}, ErrOutOfMemory},
+		{"let grow = fn(xs, n) { if (n == 0) { xs } else { let ys = grow(push(xs, [n]), n - 1); ys } }; grow([], 10000)", context.Background(), Limits{MaxBytes: 1 << 20, MaxCallDepth: 20000}, ErrOutOfMemory},
+		{"let grow = fn(s, n) { if (n == 0) { s } else { grow(s + s, n - 1) } }; grow(\"ab\", 64)", context.Background(), Limits{MaxBytes: 1 << 20}, ErrOutOfMemory},
+		{"array(0..100000000000)", context.Background(), Limits{MaxBytes: 1 << 20}, ErrOutOfMemory},
+		{"array(-9223372036854775807..9223372036854775807)", context.Background(), Limits{MaxBytes: 1 << 20}, ErrOutOfMemory},
+		{"let f = fn(n) { try { f(n + 1) } catch (e) { 0 } finally { 1 } }; f(0)", context.Background(), Limits{MaxSteps: 1000}, ErrStepLimit},
+		{"let loop = fn(n) { loop(n + 1) }; map([1], fn(x) { loop(0) })", context.Background(), Limits{Timeout: 20 * time.Millisecond}, ErrTimeout},
+		{"let loop = fn(n) { loop(n + 1) }; filter([1], fn(x) { loop(0) })", context.Background(), Limits{MaxSteps: 1000}, ErrStepLimit},
+		{"for (i in 0..1000000000) { try { i } catch (e) { e } }", cancelled, Limits{}, ErrCancelled},
+		{"let xs = [1, 2, 3]; len(xs) * 2", context.Background(), Limits{MaxSteps: 100, MaxAllocations: 10}, nil},
+		{"let xs = [1, 2, 3]; push(xs, 4)", context.Background(), Limits{MaxBytes: 200}, nil},
+		{"len(array(0..1000))", context.Background(), Limits{MaxBytes: 1 << 20}, nil},
+		{"let xs = []; for (i in 0..10000) { append!(xs, i) }; len(xs)", context.Background(), Limits{MaxBytes: 1 << 20}, nil},
+		{"let grow = fn(xs, n) { if (n == 0) { xs } else { grow(push(xs, n), n - 1) } }; grow([], 10000)", context.Background(), Limits{MaxBytes: 1 << 20}, nil},
+		{"let sum = fn(xs) { if (len(xs) == 0) { 0 } else { first(xs) + sum(rest(xs)) } }; sum(array(0..1000))", context.Background(), Limits{MaxBytes: 1 << 16}, nil},
+		{"let xss = [array(0..10000)]; for (i in 0..1000) { first(xss) }", context.Background(), Limits{MaxBytes: 1 << 18}, nil},
+		{"for (i in 0..100000) { let s = \"item \" + \"name\"; [s, s] }", context.Background(), Limits{MaxBytes: 1 << 16}, nil},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		evaluated := EvalContext(tt.ctx, program, object.NewEnvironment(), tt.limits)
+		errObj, isErr := evaluated.(*object.Error)
+
+		if tt.expected == nil {
+			if isErr {
+				t.Errorf("unexpected error: %s", errObj.Message)
+			}
+			continue
+		}
+
+		if !isErr {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if !errors.Is(errObj.Fatal, tt.expected) {
+			t.Errorf("wrong fatal error. want=%v, got=%v", tt.expected, errObj.Fatal)
+		}
+		if errObj.Message != tt.expected.Error() {
+			t.Errorf("wrong error message. want=%q, got=%q", tt.expected.Error(), errObj.Message)
+		}
+	}
+}
+
+func TestEvalStats(t *testing.T) {
+	input := `let s = "abcd" + "efgh"; let xs = [s]; let h = {"a": 1}`
+	program := testParseProgram(input)
+
+	_, stats := EvalStats(context.Background(), program, object.NewEnvironment(), Limits{})
+
+	// "abcd", "efgh", "abcdefgh", [s], "a", 1, {"a": 1}
+	if stats.Allocations != 7 {
+		t.Errorf("wrong number of allocations. want=7, got=%d", stats.Allocations)
+	}
+
+	expected := int64((16 + 4) + (16 + 4) + (16 + 8) + (24 + 16) + (16 + 1) + (48 + 64))
+	if stats.PeakBytes != expected {
+		t.Errorf("wrong peak bytes. want=%d, got=%d", expected, stats.PeakBytes)
+	}
+
+	if stats.Steps == 0 {
+		t.Errorf("no steps counted")
+	}
+
+	// strings made and dropped aren't held, so peak only counts what was
+	// made since memory was last measured
+	program = testParseProgram(`for (i in 0..100000) { "abcdefgh" + "abcdefgh" }`)
+	_, stats = EvalStats(context.Background(), program, object.NewEnvironment(), Limits{})
+	if stats.PeakBytes > 2*measureInterval {
+		t.Errorf("peak bytes too high. got=%d", stats.PeakBytes)
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -409,6 +1277,31 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`push(1, 1)`, "argument type given to `push` not supported, got=INTEGER"},
 		{`push(1, 1, 1)`, "wrong number of arguments. got=3, expected=2"},
 
+		{`array(1..4)`, []int{1, 2, 3}},
+		{`array(1..=4)`, []int{1, 2, 3, 4}},
+		{`array([1, 2])`, []int{1, 2}},
+		{`array(3..1)`, []int{}},
+		{`array(1)`, "argument type given to `array` not supported, got=INTEGER"},
+
+		{`keys({3: "c", 1: "a", 2: "b"})`, []int{3, 1, 2}},
+		{`keys({})`, []int{}},
+		{`keys([1])`, "argument type given to `keys` not supported, got=ARRAY"},
+		{`values({"c": 3, "a": 1, "b": 2, "a": 4})`, []int{3, 4, 2}},
+		{`values(1, 2)`, "wrong number of arguments. got=2, expected=1"},
+
+		{`len(upper("abc"))`, 3},
+		{`upper(1)`, "argument type given to `upper` not supported, got=INTEGER"},
+		{`len(lower("ABC"))`, 3},
+		{`map([[1], [1, 2], []], len)`, []int{1, 2, 0}},
+		{`map([1, 2], fn(x) { x * 2 })`, []int{2, 4}},
+		{`filter([1, 2, 3], fn(x) { x > 1 })`, []int{2, 3}},
+		{`map([1], fn(x, y) { x })`, "wrong number of arguments. got=1, expected=2"},
+		{`map(1, len)`, "argument type given to `map` not supported, got=INTEGER"},
+		{`map([1], 2)`, "not a function: INTEGER"},
+		{`map([1], len)`, "argument type given to `len` not supported, got=INTEGER"},
+		{`len(filter([[], [1], [2]], first))`, 2},
+		{`filter([1], len)`, "argument type given to `len` not supported, got=INTEGER"},
+
 		{`puts("hello world")`, nil},
 	}
 
@@ -429,13 +1322,13 @@ func TestBuiltinFunctions(t *testing.T) {
 				continue
 			}
 
-			if len(array.Elements) != len(expected) {
-				t.Errorf("wrong number of elements. got=%d, expected=%d", len(array.Elements), len(expected))
+			if array.Len() != len(expected) {
+				t.Errorf("wrong number of elements. got=%d, expected=%d", array.Len(), len(expected))
 				continue
 			}
 
 			for i, elem := range expected {
-				testIntegerObject(t, array.Elements[i], int64(elem))
+				testIntegerObject(t, array.Elements()[i], int64(elem))
 			}
 
 		case string:
@@ -490,6 +1383,10 @@ func TestErrorHandling(t *testing.T) {
 			}`,
 			"unknown operator: BOOLEAN + BOOLEAN",
 		},
+		{
+			"let zero = 0; 1 / zero",
+			"division by zero",
+		},
 		{
 			"foobar",
 			"identifier not found: foobar",
@@ -502,6 +1399,18 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable type given as hash key: FUNCTION",
 		},
+		{
+			"for (x in 5) { x }",
+			"cannot iterate over INTEGER",
+		},
+		{
+			`1..true`,
+			"type mismatch: INTEGER .. BOOLEAN",
+		},
+		{
+			`len >> 1`,
+			"type mismatch: BUILTIN >> INTEGER",
+		},
 	}
 
 	for _, tt := range tests {
@@ -518,8 +1427,58 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+// conformance :)
+
+// TestVMConformance runs the evaluator's tests against the compiler and vm,
+// so both backends are held to the same behaviour. TestFunctionObject is left
+// out as it inspects the evaluator's own function representation.
+func TestVMConformance(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T)
+	}{
+		{"EvalIntegerExpression", TestEvalIntegerExpression},
+		{"EvalStringExpression", TestEvalStringExpression},
+		{"EvalBooleanExpression", TestEvalBooleanExpression},
+		{"EvalIfElseExpression", TestEvalIfElseExpression},
+		{"ArrayLiterals", TestArrayLiterals},
+		{"ArrayIndexExpressions", TestArrayIndexExpressions},
+		{"HashLiterals", TestHashLiterals},
+		{"HashOrder", TestHashOrder},
+		{"SetLiterals", TestSetLiterals},
+		{"MutatingBuiltins", TestMutatingBuiltins},
+		{"HashIndexExpressions", TestHashIndexExpressions},
+		{"RangeExpressions", TestRangeExpressions},
+		{"RangeInspect", TestRangeInspect},
+		{"InExpressions", TestInExpressions},
+		{"ErrorValueFields", TestErrorValueFields},
+		{"ForExpressions", TestForExpressions},
+		{"PipeAndComposeExpressions", TestPipeAndComposeExpressions},
+		{"ReturnStatement", TestReturnStatement},
+		{"LetStatement", TestLetStatement},
+		{"FunctionApplication", TestFunctionApplication},
+		{"ArrowFunctionApplication", TestArrowFunctionApplication},
+		{"Closures", TestClosures},
+		{"BuiltinFunctions", TestBuiltinFunctions},
+		{"MethodCalls", TestMethodCalls},
+		{"ErrorHandling", TestErrorHandling},
+	}
+
+	testEval = testCompileAndRun
+	defer func() { testEval = testEvaluate }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.fn)
+	}
+}
+
 // generic funcs :)
-func testEval(input string) object.Object {
+
+// testEval runs input on the backend under test, which is the evaluator
+// unless TestVMConformance has swapped in the vm.
+var testEval = testEvaluate
+
+func testEvaluate(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
@@ -528,6 +1487,24 @@ func testEval(input string) object.Object {
 	return Eval(program, env)
 }
 
+func testCompileAndRun(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	machine := vm.New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	return machine.LastPoppedStackElem()
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, ok := obj.(*object.Integer)
 	if !ok {
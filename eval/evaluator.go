@@ -0,0 +1,390 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"strings"
+	"time"
+)
+
+// DefaultMaxCallDepth is how deep function calls may nest before evaluation
+// stops with a stack overflow error. Calls in tail position don't count.
+const DefaultMaxCallDepth = 10000
+
+// shownFrames is how many of the innermost frames a stack overflow lists.
+const shownFrames = 5
+
+// maxTraceFrames caps how many frames an error's trace collects.
+const maxTraceFrames = 20
+
+// summaryLength caps the length, in characters, of each argument shown in a
+// trace.
+const summaryLength = 20
+
+// checkInterval is how many steps pass between checks of the context, which
+// are too slow to make on every step.
+const checkInterval = 1024
+
+// measureInterval is the least that's made between measurements of the
+// memory held, which take time in proportion to it.
+const measureInterval = 1 << 20
+
+// Errors set as object.Error.Fatal when evaluation is stopped from outside.
+var (
+	ErrCancelled       = errors.New("evaluation cancelled")
+	ErrTimeout         = errors.New("evaluation timed out")
+	ErrStepLimit       = errors.New("step limit exceeded")
+	ErrAllocationLimit = errors.New("allocation limit exceeded")
+	ErrOutOfMemory     = errors.New("out of memory")
+)
+
+// Limits bounds what a single evaluation may do. MaxCallDepth falls back to
+// DefaultMaxCallDepth when zero; the other limits are off when zero.
+type Limits struct {
+	MaxCallDepth   int
+	MaxSteps       int           // nodes evaluated
+	MaxAllocations int           // objects created
+	MaxBytes       int64         // bytes held in strings, arrays and hashes at once
+	Timeout        time.Duration // wall time
+}
+
+// Stats reports what an evaluation used.
+type Stats struct {
+	Steps       int
+	Allocations int
+
+	// PeakBytes is the most memory held in strings, arrays and hashes at
+	// once. What's held is measured now and then, and everything made since
+	// the last measurement is taken to still be held, so this can be high by
+	// what was made and dropped in between: at most what was held when last
+	// measured, or a megabyte.
+	PeakBytes int64
+}
+
+// EvalWithLimits is Eval with the given limits in place of the defaults.
+func EvalWithLimits(node ast.Node, env *object.Environment, limits Limits) object.Object {
+	return EvalContext(context.Background(), node, env, limits)
+}
+
+// EvalContext evaluates node until it's done, ctx is done or it runs over one
+// of limits. Evaluation stopped early returns an *object.Error whose Fatal is
+// one of ErrCancelled, ErrTimeout, ErrStepLimit, ErrAllocationLimit or
+// ErrOutOfMemory.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) object.Object {
+	result, _ := EvalStats(ctx, node, env, limits)
+	return result
+}
+
+// EvalStats is EvalContext, also reporting what the evaluation used.
+func EvalStats(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) (object.Object, Stats) {
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	builtins := env.Builtins()
+	calls := &goCalls{fresh: func() (*evaluator, func()) {
+		ctx, cancel := context.Background(), func() {}
+		if limits.Timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		}
+		e := newEvaluator(limits, builtins)
+		e.ctx = ctx
+		return e, cancel
+	}}
+	env.SetCaller(calls.call)
+
+	e := newEvaluator(limits, builtins)
+	e.ctx = ctx
+	result := calls.run(e, func() object.Object { return e.evalScope(node, env) })
+
+	return result, Stats{Steps: e.steps, Allocations: e.allocations, PeakBytes: e.peak}
+}
+
+// goCalls makes the calls Go code makes to functions defined in an
+// environment, such as funcs made by object.ToGo. While an evaluation in the
+// environment is running they're part of it, sharing its context, limits,
+// counts and call stack, so a builtin can't be used to get around them.
+// Otherwise each call is an evaluation of its own, made by fresh.
+//
+// Calls join the running evaluation whichever goroutine they're made on, and
+// evaluations aren't safe for concurrent use, so Go code must only call back
+// into a running evaluation from the goroutine running it.
+type goCalls struct {
+	running *evaluator
+	fresh   func() (*evaluator, func()) // the evaluator, and what to do when it's done
+}
+
+// run runs f, which evaluates something on e, with calls from Go joining e.
+func (c *goCalls) run(e *evaluator, f func() object.Object) object.Object {
+	outer := c.running
+	c.running = e
+	defer func() { c.running = outer }()
+
+	return f()
+}
+
+// call is the object.Caller for Go code calling fn.
+func (c *goCalls) call(fn object.Object, args ...object.Object) object.Object {
+	if c.running != nil {
+		return c.running.applyFunction(goCall, fn, args)
+	}
+
+	e, done := c.fresh()
+	defer done()
+	return c.run(e, func() object.Object { return e.applyFunction(goCall, fn, args) })
+}
+
+// evaluator holds the state of one evaluation, such as the call stack.
+type evaluator struct {
+	ctx        context.Context
+	limits     Limits
+	builtins   []object.BuiltinDefinition
+	methods    map[object.ObjectType]map[string]*object.Builtin // by receiver type, then name
+	errorTrace *object.Builtin                                  // looked up once, since every call checks for it
+	frames     []frame
+	scopes     []*object.Environment // in use, for measuring what's held
+	pinned     []object.Object       // arguments to builtins being called, likewise
+
+	modulePaths []string // where imports are looked for
+	importRoot  string   // if set, the directory imports must be in, with symlinks resolved
+	noImports   bool
+	importing   []importing // modules being evaluated, innermost last
+
+	steps       int
+	allocations int
+	bytes       int64 // held when last measured, and made since
+	peak        int64
+	nextMeasure int64 // what bytes has to pass for what's held to be measured again
+}
+
+func newEvaluator(limits Limits, builtins []object.BuiltinDefinition) *evaluator {
+	if limits.MaxCallDepth <= 0 {
+		limits.MaxCallDepth = DefaultMaxCallDepth
+	}
+	e := &evaluator{ctx: context.Background(), limits: limits, builtins: builtins, methods: object.MethodTable(builtins)}
+	e.errorTrace = e.builtin("error_trace")
+	e.scheduleMeasure()
+	return e
+}
+
+func (e *evaluator) builtin(name string) *object.Builtin {
+	for _, def := range e.builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+// step counts a node evaluated, checking the step limit and every so often
+// the context.
+func (e *evaluator) step() *object.Error {
+	e.steps++
+
+	if e.limits.MaxSteps > 0 && e.steps > e.limits.MaxSteps {
+		return fatalError(ErrStepLimit)
+	}
+
+	if e.steps%checkInterval == 0 {
+		switch e.ctx.Err() {
+		case nil:
+		case context.DeadlineExceeded:
+			return fatalError(ErrTimeout)
+		default:
+			return fatalError(ErrCancelled)
+		}
+	}
+
+	return nil
+}
+
+// track counts obj against the allocation limits if it's newly made, which
+// singletons and errors never are. Everything builtins return is taken to be
+// new.
+func (e *evaluator) track(obj object.Object) object.Object {
+	return e.trackSize(obj, object.SizeOf(obj))
+}
+
+// trackSize is track for obj, which took size bytes to make.
+func (e *evaluator) trackSize(obj object.Object, size int64) object.Object {
+	switch obj.(type) {
+	case nil, *object.Boolean, *object.Null, *object.Error, *tailCall:
+		return obj
+	}
+
+	e.allocations++
+	if e.limits.MaxAllocations > 0 && e.allocations > e.limits.MaxAllocations {
+		return fatalError(ErrAllocationLimit)
+	}
+
+	return e.charge(obj, size)
+}
+
+// charge counts size more bytes as held on obj's account. Values that are no
+// longer held aren't given back one by one, so once the count passes the
+// next measurement, or the memory limit, what's held is measured instead;
+// evaluation is only stopped if that's over the limit.
+func (e *evaluator) charge(obj object.Object, size int64) object.Object {
+	e.bytes += size
+	if e.bytes > e.nextMeasure {
+		e.measure(obj)
+		if e.limits.MaxBytes > 0 && e.bytes > e.limits.MaxBytes {
+			return fatalError(ErrOutOfMemory)
+		}
+	}
+
+	e.peak = max(e.peak, e.bytes)
+	return obj
+}
+
+// reserve checks that size more bytes would fit under the memory limit, so
+// builtins that would go over can be refused before they allocate anything.
+func (e *evaluator) reserve(size int64) *object.Error {
+	if e.limits.MaxBytes <= 0 || size <= e.limits.MaxBytes-e.bytes {
+		return nil
+	}
+
+	e.measure()
+	if size > e.limits.MaxBytes-e.bytes {
+		return fatalError(ErrOutOfMemory)
+	}
+	return nil
+}
+
+// measure sets bytes to what's held: everything reachable from the
+// environments in use, the arguments of calls being made, and extra. Values
+// only held partway through evaluating an expression, such as the elements
+// of an array literal before the array is made, aren't seen.
+func (e *evaluator) measure(extra ...object.Object) {
+	m := object.NewMeter()
+	for _, env := range e.scopes {
+		m.Environment(env)
+	}
+	for _, f := range e.frames {
+		for _, arg := range f.args {
+			m.Object(arg)
+		}
+	}
+	for _, obj := range e.pinned {
+		m.Object(obj)
+	}
+	for _, obj := range extra {
+		m.Object(obj)
+	}
+
+	e.bytes = m.Bytes()
+	e.scheduleMeasure()
+}
+
+// scheduleMeasure sets when what's held is next measured: once as much again
+// has been made, so measuring takes time in proportion to what's made, but
+// no later than it takes to go over the memory limit.
+func (e *evaluator) scheduleMeasure() {
+	e.nextMeasure = e.bytes + max(e.bytes, measureInterval)
+	if e.limits.MaxBytes > 0 {
+		e.nextMeasure = min(e.nextMeasure, e.limits.MaxBytes)
+	}
+}
+
+// evalScope evaluates node in env, counting what env holds as in use while
+// it does.
+func (e *evaluator) evalScope(node ast.Node, env *object.Environment) object.Object {
+	e.scopes = append(e.scopes, env)
+	defer func() { e.scopes = e.scopes[:len(e.scopes)-1] }()
+
+	return e.eval(node, env)
+}
+
+func fatalError(err error) *object.Error {
+	return &object.Error{Message: err.Error(), Fatal: err}
+}
+
+func isFatal(obj object.Object) bool {
+	err, ok := obj.(*object.Error)
+	return ok && err.Fatal != nil
+}
+
+func (e *evaluator) pushFrame(f frame) *object.Error {
+	if len(e.frames) >= e.limits.MaxCallDepth {
+		return e.stackOverflow()
+	}
+	e.frames = append(e.frames, f)
+	return nil
+}
+
+func (e *evaluator) popFrame() {
+	e.frames = e.frames[:len(e.frames)-1]
+}
+
+func (e *evaluator) stackOverflow() *object.Error {
+	names := []string{}
+	for i := len(e.frames) - 1; i >= 0 && len(names) < shownFrames; i-- {
+		names = append(names, e.frames[i].function())
+	}
+	if hidden := len(e.frames) - len(names); hidden > 0 {
+		names = append(names, fmt.Sprintf("... %d more", hidden))
+	}
+
+	return newError(object.RECURSION_ERROR, "stack overflow: maximum call depth of %d exceeded in %s",
+		e.limits.MaxCallDepth, strings.Join(names, ", "))
+}
+
+// addTrace records the innermost frame on an error leaving it.
+func (e *evaluator) addTrace(err *object.Error) {
+	if len(err.Trace) < maxTraceFrames {
+		err.Trace = append(err.Trace, e.frames[len(e.frames)-1].trace())
+	}
+}
+
+// frame is a call being made. Its arguments are only summarized if an error
+// passes through it, so calls that don't fail don't pay for that.
+type frame struct {
+	call *ast.CallExpression
+	args []object.Object
+}
+
+func newFrame(call *ast.CallExpression, args []object.Object) frame {
+	return frame{call: call, args: args}
+}
+
+func (f frame) function() string {
+	return f.call.Function.String()
+}
+
+// trace makes the frame an error's trace shows for f.
+func (f frame) trace() object.Frame {
+	traced := object.Frame{
+		Function: f.function(),
+		Line:     f.call.Token.Line,
+		Column:   f.call.Token.Column,
+	}
+
+	for _, arg := range f.args {
+		traced.Args = append(traced.Args, summarize(arg))
+	}
+
+	return traced
+}
+
+func summarize(obj object.Object) string {
+	var summary string
+
+	switch obj := obj.(type) {
+	case *object.Function, *object.Builtin:
+		return "fn"
+	case *object.String:
+		summary = fmt.Sprintf("%q", obj.Value)
+	default:
+		summary = obj.Inspect()
+	}
+
+	if runes := []rune(summary); len(runes) > summaryLength {
+		summary = string(runes[:summaryLength-3]) + "..."
+	}
+	return summary
+}
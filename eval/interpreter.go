@@ -0,0 +1,233 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Options configures an Interpreter. Streams left nil are the process's.
+type Options struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	Limits Limits
+
+	// ModulePaths are searched in order for imports that aren't found next
+	// to the importing file.
+	ModulePaths []string
+
+	// ImportRoot, if set, is the directory every import has to be in, for
+	// hosts running code they don't trust: modules found outside it, through
+	// "..", an absolute path or a symlink, are as good as missing, and code
+	// that isn't from a file imports from it rather than the working
+	// directory. NoImports refuses imports altogether.
+	ImportRoot string
+	NoImports  bool
+}
+
+// Interpreter runs Monkey code for a host program. Each one has its own
+// globals, macros, builtins, streams and limits, so separate Interpreters can
+// be used from separate goroutines freely. A single Interpreter is safe to
+// share too, but runs one thing at a time.
+//
+// Go funcs made of the interpreter's functions, by object.ToGo, take the
+// interpreter's lock when called while it's idle. Called while it's running,
+// as by a builtin, they run as part of what it's running, and so must be
+// called from the goroutine running it.
+type Interpreter struct {
+	mu sync.Mutex
+
+	env         *object.Environment
+	macros      *object.Environment
+	limits      Limits
+	modulePaths []string
+	importRoot  string
+	noImports   bool
+	calls       *goCalls
+}
+
+func NewInterpreter(opts Options) *Interpreter {
+	if opts.Stdin == nil {
+		opts.Stdin = os.Stdin
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+
+	builtins := object.NewBuiltins(opts.Stdin, opts.Stdout, opts.Stderr)
+
+	i := &Interpreter{
+		env:         object.NewEnvironmentWithBuiltins(builtins),
+		macros:      object.NewEnvironmentWithBuiltins(builtins),
+		limits:      opts.Limits,
+		modulePaths: opts.ModulePaths,
+		importRoot:  realPath(opts.ImportRoot),
+		noImports:   opts.NoImports,
+	}
+	i.calls = &goCalls{fresh: func() (*evaluator, func()) {
+		i.mu.Lock()
+		e, cancel := i.evaluator(context.Background())
+		return e, func() {
+			cancel()
+			i.mu.Unlock()
+		}
+	}}
+	i.env.SetCaller(i.calls.call)
+	return i
+}
+
+// Run evaluates source in the interpreter's global environment, so later runs
+// see its bindings. Errors in source, and the errors it evaluates to, are
+// returned as errors; the latter are *object.Error.
+func (i *Interpreter) Run(source string) (object.Object, error) {
+	return i.RunContext(context.Background(), source)
+}
+
+// RunContext is Run, stopping early if ctx is done.
+func (i *Interpreter) RunContext(ctx context.Context, source string) (object.Object, error) {
+	return i.run(ctx, source, nil)
+}
+
+// RunFile is Run with the source of the file at path. Imports are looked for
+// next to the file, and the file may not import itself.
+func (i *Interpreter) RunFile(path string) (object.Object, error) {
+	return i.RunFileContext(context.Background(), path)
+}
+
+// RunFileContext is RunFile, stopping early if ctx is done.
+func (i *Interpreter) RunFileContext(ctx context.Context, path string) (object.Object, error) {
+	source, file, err := readModuleFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return i.run(ctx, source, &file)
+}
+
+// run evaluates source, which was read from file if it isn't nil.
+func (i *Interpreter) run(ctx context.Context, source string, file *importing) (object.Object, error) {
+	l := lexer.New(source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	e, cancel := i.evaluator(ctx)
+	defer cancel()
+	if file != nil {
+		e.importing = []importing{*file}
+	}
+
+	e.defineMacros(program, i.macros)
+	expanded, err := e.expandMacros(program, i.macros)
+	if err != nil {
+		return nil, err
+	}
+
+	return result(i.calls.run(e, func() object.Object { return e.evalScope(expanded, i.env) }))
+}
+
+// Call calls the global or builtin function named fnName with args.
+func (i *Interpreter) Call(fnName string, args ...object.Object) (object.Object, error) {
+	return i.CallContext(context.Background(), fnName, args...)
+}
+
+// CallContext is Call, stopping early if ctx is done.
+func (i *Interpreter) CallContext(ctx context.Context, fnName string, args ...object.Object) (object.Object, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	e, cancel := i.evaluator(ctx)
+	defer cancel()
+
+	fn, ok := i.env.Get(fnName)
+	if !ok {
+		builtin := e.builtin(fnName)
+		if builtin == nil {
+			return nil, fmt.Errorf("identifier not found: %s", fnName)
+		}
+		fn = builtin
+	}
+
+	call := &ast.CallExpression{Function: &ast.Identifier{Value: fnName}}
+	return result(i.calls.run(e, func() object.Object { return e.applyFunction(call, fn, args) }))
+}
+
+// Get returns the global called name.
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.env.Get(name)
+}
+
+// Set binds a global for code run afterwards.
+func (i *Interpreter) Set(name string, value object.Object) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.env.Set(name, value)
+}
+
+// RegisterBuiltin adds def to this interpreter's builtins, replacing any of
+// the same name. See object.WithBuiltin.
+func (i *Interpreter) RegisterBuiltin(def object.BuiltinDefinition) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	builtins, err := object.WithBuiltin(i.env.Builtins(), def)
+	if err != nil {
+		return err
+	}
+	i.env.SetBuiltins(builtins)
+	i.macros.SetBuiltins(builtins)
+	return nil
+}
+
+// Builtins lists this interpreter's builtins.
+func (i *Interpreter) Builtins() []object.BuiltinDefinition {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return append([]object.BuiltinDefinition{}, i.env.Builtins()...)
+}
+
+func (i *Interpreter) evaluator(ctx context.Context) (*evaluator, context.CancelFunc) {
+	cancel := func() {}
+	if i.limits.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, i.limits.Timeout)
+	}
+
+	e := newEvaluator(i.limits, i.env.Builtins())
+	e.ctx = ctx
+	e.modulePaths = i.modulePaths
+	e.importRoot = i.importRoot
+	e.noImports = i.noImports
+	return e, cancel
+}
+
+func result(obj object.Object) (object.Object, error) {
+	switch obj := obj.(type) {
+	case nil:
+		return object.NULL, nil
+	case *object.Error:
+		return nil, obj
+	default:
+		return obj, nil
+	}
+}
@@ -0,0 +1,326 @@
+package eval
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"monkey/object"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInterpreterRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	interp := NewInterpreter(Options{
+		Stdin:  strings.NewReader("monkey\nbusiness"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+
+	if _, err := interp.Run(`let name = gets(); puts("hello " + name); eputs("oops")`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	evaluated, err := interp.Run(`let unless = macro(c, x) { quote(if (!(unquote(c))) { unquote(x) }) }; unless(false, gets())`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if str, ok := evaluated.(*object.String); !ok || str.Value != "business" {
+		t.Errorf("wrong result. got=%+v", evaluated)
+	}
+
+	evaluated, err = interp.Run(`gets()`)
+	if err != nil || evaluated != NULL {
+		t.Errorf("gets at end of input should be null. got=%+v (%v)", evaluated, err)
+	}
+
+	if stdout.String() != "hello monkey\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+	if stderr.String() != "oops\n" {
+		t.Errorf("wrong stderr. got=%q", stderr.String())
+	}
+}
+
+func TestInterpreterErrors(t *testing.T) {
+	interp := NewInterpreter(Options{Limits: Limits{Timeout: 20 * time.Millisecond}})
+
+	if _, err := interp.Run("let = 5;"); err == nil {
+		t.Errorf("expected parse error")
+	}
+
+	_, err := interp.Run("let f = fn(x) { x + true }; f(1)")
+	var errObj *object.Error
+	if !errors.As(err, &errObj) {
+		t.Fatalf("error is not *object.Error. got=%T (%v)", err, err)
+	}
+	if errObj.Message != "type mismatch: INTEGER + BOOLEAN" || len(errObj.Trace) != 1 {
+		t.Errorf("wrong error. got=%q with %d frames", errObj.Message, len(errObj.Trace))
+	}
+
+	if _, err := interp.Run("let loop = fn() { loop() }; loop()"); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected timeout. got=%v", err)
+	}
+
+	// composed functions run on the evaluator calling them, not the one
+	// that made them, whose context is done by now
+	if _, err := interp.Run("let inc = fn(x) { x + 1 }; let twice = inc >> inc"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result, err := interp.Run("twice(1)"); err != nil || result.Inspect() != "3" {
+		t.Errorf("wrong result. want=3, got=%v (%v)", result, err)
+	}
+
+	// functions called from Go are held to the same limits
+	evaluated, err := interp.Run("fn() { loop() }")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var run func() error
+	if err := object.ToGo(evaluated, &run); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	if err := run(); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected timeout from Go. got=%v", err)
+	}
+}
+
+func TestInterpreterCall(t *testing.T) {
+	interp := NewInterpreter(Options{})
+
+	if _, err := interp.Run("let offset = 10; let add = fn(a, b) { a + b + offset };"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	evaluated, err := interp.Call("add", &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testIntegerObject(t, evaluated, 13)
+
+	interp.Set("offset", &object.Integer{Value: 100})
+	evaluated, _ = interp.Call("add", &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	testIntegerObject(t, evaluated, 103)
+
+	evaluated, _ = interp.Call("len", &object.String{Value: "four"})
+	testIntegerObject(t, evaluated, 4)
+
+	tests := []struct {
+		fnName   string
+		args     []object.Object
+		expected string
+	}{
+		{"missing", nil, "identifier not found: missing"},
+		{"add", []object.Object{&object.Integer{Value: 1}}, "wrong number of arguments. got=1, expected=2"},
+		{"add", []object.Object{TRUE, TRUE}, "unknown operator: BOOLEAN + BOOLEAN"},
+		{"offset", nil, "not a function: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		_, err := interp.Call(tt.fnName, tt.args...)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestInterpretersRunConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	outputs := make([]bytes.Buffer, 8)
+
+	for n := range outputs {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+
+			interp := NewInterpreter(Options{Stdout: &outputs[n]})
+			source := fmt.Sprintf("let n = %d; let f = fn(i) { if (i == 0) { 0 } else { n + f(i - 1) } }; puts(f(100))", n)
+			if _, err := interp.Run(source); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}(n)
+	}
+
+	wg.Wait()
+
+	for n := range outputs {
+		expected := fmt.Sprintf("%d\n", n*100)
+		if outputs[n].String() != expected {
+			t.Errorf("interpreter %d printed wrong output. want=%q, got=%q", n, expected, outputs[n].String())
+		}
+	}
+}
+
+func TestInterpreterRegisterBuiltin(t *testing.T) {
+	var stdout bytes.Buffer
+	interp := NewInterpreter(Options{Stdout: &stdout})
+	other := NewInterpreter(Options{})
+
+	repeat, err := object.FuncBuiltin("repeat", "repeat(s, n) joins n copies of s.", func(s string, n int) (string, error) {
+		if n < 0 {
+			return "", errors.New("can't repeat a negative number of times")
+		}
+		return strings.Repeat(s, n), nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	repeat.Methods = []object.ObjectType{object.STRING_OBJ}
+	if err := interp.RegisterBuiltin(repeat); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err = interp.RegisterBuiltin(object.BuiltinDefinition{
+		Name:    "puts",
+		Arity:   1,
+		Builtin: &object.Builtin{Fn: func(args ...object.Object) object.Object { return &object.String{Value: "quiet"} }},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	evaluated, err := interp.Run(`puts(repeat("ab", 2) |> len)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if str, ok := evaluated.(*object.String); !ok || str.Value != "quiet" || stdout.Len() != 0 {
+		t.Errorf("puts not replaced. got=%+v, printed %q", evaluated, stdout.String())
+	}
+
+	evaluated, err = interp.Run(`"ab".repeat(3)`)
+	if err != nil || evaluated.Inspect() != "ababab" {
+		t.Errorf("wrong result for method. want=ababab, got=%v (%v)", evaluated, err)
+	}
+
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{`repeat("ab", -1)`, "can't repeat a negative number of times"},
+		{`repeat(1, 2)`, "argument 1 to `repeat` must be STRING, got=INTEGER"},
+		{`repeat("ab")`, "wrong number of arguments. got=1, expected=2"},
+	}
+
+	for _, tt := range tests {
+		_, err := interp.Run(tt.source)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+
+	if _, err := other.Run(`repeat("ab", 2)`); err == nil || err.Error() != "identifier not found: repeat" {
+		t.Errorf("builtin leaked into another interpreter. got=%v", err)
+	}
+
+	found := false
+	for _, def := range interp.Builtins() {
+		if def.Name == "repeat" && def.Doc == "repeat(s, n) joins n copies of s." && def.Arity == 2 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("repeat not listed in Builtins")
+	}
+}
+
+func TestInterpreterFunctionsFromGo(t *testing.T) {
+	interp := NewInterpreter(Options{})
+	if err := interp.RegisterBuiltin(object.BuiltinDefinition{
+		Name:    "twice",
+		Arity:   1,
+		Builtin: &object.Builtin{Fn: func(args ...object.Object) object.Object { return &object.Integer{Value: 2} }},
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	evaluated, err := interp.Run(`fn(name, scores) { { "greeting": "hi " + name, "total": scores[0] * twice(0) } }`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var summarize func(string, []int) (map[string]interface{}, error)
+	if err := object.ToGo(evaluated, &summarize); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+
+	summary, err := summarize("monkey", []int{21})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if summary["greeting"] != "hi monkey" || summary["total"] != int64(42) {
+		t.Errorf("wrong summary. got=%v", summary)
+	}
+
+	_, err = summarize("monkey", nil)
+	if err == nil || err.Error() != "type mismatch: NULL * INTEGER" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	apply, err := object.FuncBuiltin("apply", "", func(f func(int) int, n int) int { return f(n) })
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := interp.RegisterBuiltin(apply); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err = interp.Run("apply(fn(n) { n / 0 }, 1)")
+	if err == nil || err.Error() != "division by zero" {
+		t.Errorf("wrong error from failing callback. got=%v", err)
+	}
+
+	args, err := object.FromGo([]interface{}{"gopher", []int{5}})
+	if err != nil {
+		t.Fatalf("FromGo failed: %s", err)
+	}
+	result, err := interp.Call("len", args.(*object.Array).Elements()[:1]...)
+	if err != nil || result.Inspect() != "6" {
+		t.Errorf("wrong result. want=6, got=%v (%v)", result, err)
+	}
+}
+
+func TestInterpreterCallbacksShareLimits(t *testing.T) {
+	repeat, err := object.FuncBuiltin("repeat", "", func(n int, f func() error) error {
+		for i := 0; i < n; i++ {
+			if err := f(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		input    string
+		limits   Limits
+		expected error
+	}{
+		{"repeat(100, fn() { for (i in 0..100) { i } })", Limits{MaxSteps: 5000}, ErrStepLimit},
+		{"repeat(1000000, fn() { for (i in 0..100) { i } })", Limits{Timeout: 50 * time.Millisecond}, ErrTimeout},
+		{"let f = fn() { repeat(1, f) }; f()", Limits{MaxCallDepth: 100}, nil},
+	}
+
+	for _, tt := range tests {
+		interp := NewInterpreter(Options{Limits: tt.limits})
+		if err := interp.RegisterBuiltin(repeat); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		_, err := interp.Run(tt.input)
+		var errObj *object.Error
+		if !errors.As(err, &errObj) {
+			t.Errorf("expected an error for %q. got=%v", tt.input, err)
+			continue
+		}
+		if tt.expected == nil {
+			if errObj.Kind != object.RECURSION_ERROR {
+				t.Errorf("expected stack overflow for %q. got=%q", tt.input, errObj.Message)
+			}
+		} else if !errors.Is(errObj.Fatal, tt.expected) {
+			t.Errorf("wrong fatal error for %q. want=%v, got=%v", tt.input, tt.expected, errObj.Fatal)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package eval
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+)
+
+// quote & unquote :)
+func (e *evaluator) quote(node ast.Node, env *object.Environment) object.Object {
+	node = e.evalUnquoteCalls(ast.Copy(node), env)
+	return &object.Quote{Node: node}
+}
+
+func (e *evaluator) evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
+	return ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if !isUnquoteCall(node) {
+			return node
+		}
+
+		call, ok := node.(*ast.CallExpression)
+		if !ok || len(call.Arguments) != 1 {
+			return node
+		}
+
+		unquoted := e.eval(call.Arguments[0], env)
+		return convertObjectToASTNode(unquoted)
+	})
+}
+
+func isUnquoteCall(node ast.Node) bool {
+	call, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+
+	return call.Function.TokenLiteral() == "unquote"
+}
+
+func convertObjectToASTNode(obj object.Object) ast.Node {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value)}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}
+
+	case *object.Boolean:
+		var t token.Token
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		} else {
+			t = token.Token{Type: token.FALSE, Literal: "false"}
+		}
+		return &ast.BooleanLiteral{Token: t, Value: obj.Value}
+
+	case *object.Quote:
+		return obj.Node
+
+	default:
+		return nil
+	}
+}
+
+// macro expansion :)
+
+// DefineMacros removes every top-level `let name = macro(...) { ... }` from
+// program and binds the resulting macros in env.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	newEvaluator(Limits{}, env.Builtins()).defineMacros(program, env)
+}
+
+func (e *evaluator) defineMacros(program *ast.Program, env *object.Environment) {
+	definitions := []int{}
+
+	for i, stmt := range program.Statements {
+		if isMacroDefinition(stmt) {
+			e.addMacro(stmt, env)
+			definitions = append(definitions, i)
+		}
+	}
+
+	for i := len(definitions) - 1; i >= 0; i-- {
+		definitionIndex := definitions[i]
+		program.Statements = append(
+			program.Statements[:definitionIndex],
+			program.Statements[definitionIndex+1:]...,
+		)
+	}
+}
+
+func isMacroDefinition(node ast.Statement) bool {
+	letStatement, ok := node.(*ast.LetStatement)
+	if !ok {
+		return false
+	}
+
+	_, ok = letStatement.Value.(*ast.MacroLiteral)
+	return ok
+}
+
+func (e *evaluator) addMacro(stmt ast.Statement, env *object.Environment) {
+	letStatement, _ := stmt.(*ast.LetStatement)
+	macroLiteral, _ := letStatement.Value.(*ast.MacroLiteral)
+	resolveMacro(macroLiteral, env, e.builtins)
+
+	macro := &object.Macro{
+		Parameters: macroLiteral.Parameters,
+		Env:        env,
+		Body:       macroLiteral.Body,
+	}
+
+	env.Set(letStatement.Name.Value, macro)
+}
+
+// ExpandMacros replaces every call to a macro defined in env with the quoted
+// AST the macro returns. Arguments are passed to the macro unevaluated.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	return newEvaluator(Limits{}, env.Builtins()).expandMacros(program, env)
+}
+
+func (e *evaluator) expandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var expandErr error
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		callExpression, ok := node.(*ast.CallExpression)
+		if !ok || expandErr != nil {
+			return node
+		}
+
+		macro, ok := isMacroCall(callExpression, env)
+		if !ok {
+			return node
+		}
+
+		if len(callExpression.Arguments) != len(macro.Parameters) {
+			expandErr = fmt.Errorf("wrong number of arguments to macro `%s`. got=%d, expected=%d",
+				callExpression.Function.String(), len(callExpression.Arguments), len(macro.Parameters))
+			return node
+		}
+
+		args := quoteArgs(callExpression)
+		evalEnv := extendMacroEnv(macro, args)
+
+		evaluated := unwrapReturnValue(e.eval(macro.Body, evalEnv))
+		if err, ok := evaluated.(*object.Error); ok {
+			expandErr = fmt.Errorf("error expanding macro `%s`: %s", callExpression.Function.String(), err.Message)
+			return node
+		}
+
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			expandErr = fmt.Errorf("macro `%s` must return a quoted AST node, got=%s",
+				callExpression.Function.String(), typeOf(evaluated))
+			return node
+		}
+
+		return quote.Node
+	})
+
+	if expandErr != nil {
+		return nil, expandErr
+	}
+
+	return expanded, nil
+}
+
+func typeOf(obj object.Object) object.ObjectType {
+	if obj == nil {
+		return object.NULL_OBJ
+	}
+	return obj.Type()
+}
+
+func isMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := exp.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		return nil, false
+	}
+
+	return macro, true
+}
+
+func quoteArgs(exp *ast.CallExpression) []*object.Quote {
+	args := []*object.Quote{}
+
+	for _, a := range exp.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+
+	return args
+}
+
+func extendMacroEnv(macro *object.Macro, args []*object.Quote) *object.Environment {
+	extended := object.NewEnclosedEnvironment(macro.Env)
+
+	for paramIdx, param := range macro.Parameters {
+		bind(extended, param, args[paramIdx])
+	}
+
+	return extended
+}
@@ -0,0 +1,234 @@
+package eval
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+// quote & unquote :)
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testQuoteObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`quote(unquote("monkey"))`, `monkey`},
+		{
+			`let quotedInfixExpression = quote(4 + 4);
+			quote(unquote(4 + 4) + unquote(quotedInfixExpression))`,
+			`(8 + (4 + 4))`,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testQuoteObject(t, evaluated, tt.expected)
+	}
+}
+
+// macro expansion :)
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	_, ok := env.Get("number")
+	if ok {
+		t.Fatalf("number should not be defined")
+	}
+	_, ok = env.Get("function")
+	if ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+
+	if macro.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", macro.Parameters[0])
+	}
+	if macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameter is not 'y'. got=%q", macro.Parameters[1])
+	}
+
+	expectedBody := "(x + y)"
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+			let infixExpression = macro() { quote(1 + 2); };
+
+			infixExpression();
+			`,
+			`(1 + 2)`,
+		},
+		{
+			`
+			let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+
+			reverse(2 + 2, 10 - 5);
+			`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			`
+			let twice = macro(x) { quote(unquote(x) + unquote(x)); };
+
+			twice(1);
+			twice(2);
+			`,
+			`(1 + 1); (2 + 2)`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("unexpected expansion error: %s", err)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let m = macro(a) { quote(unquote(a)) }; m(1, 2)`,
+			"wrong number of arguments to macro `m`. got=2, expected=1",
+		},
+		{
+			`let m = macro() { 5 }; m()`,
+			"macro `m` must return a quoted AST node, got=INTEGER",
+		},
+		{
+			`let m = macro() { foo }; m()`,
+			"error expanding macro `m`: identifier not found: foo",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("expected expansion error %q, got none", tt.expected)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+// helpers :)
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testQuoteObject(t *testing.T, obj object.Object, expected string) bool {
+	quote, ok := obj.(*object.Quote)
+	if !ok {
+		t.Errorf("expected *object.Quote. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if quote.Node == nil {
+		t.Errorf("quote.Node is nil")
+		return false
+	}
+
+	if quote.Node.String() != expected {
+		t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), expected)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,187 @@
+package eval
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Modules are files imported with `import "path" as name;`. A module is run
+// in an environment of its own, once per program however many times it's
+// imported, and the values of its top-level `export let`s are what importers
+// see as members of name.
+//
+// Relative paths are looked for next to the importing file first (or in the
+// working directory for code that didn't come from a file), then in each of
+// the evaluator's module paths in turn. A host can confine imports to one
+// directory, its import root, or turn them off.
+
+// importing is a module being evaluated, kept to catch import cycles.
+type importing struct {
+	path string // absolute
+	name string // as it was imported
+}
+
+func (e *evaluator) evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	if e.noImports {
+		return newError(object.IMPORT_ERROR, "imports are not allowed: %s", node.Path.Value)
+	}
+
+	path, ok := e.findModule(node.Path.Value)
+	if !ok {
+		return newError(object.IMPORT_ERROR, "module not found: %s", node.Path.Value)
+	}
+
+	modules := env.Modules()
+	if module, ok := modules[path]; ok {
+		return module
+	}
+
+	for i, imp := range e.importing {
+		if imp.path == path {
+			cycle := []string{}
+			for _, imp := range e.importing[i:] {
+				cycle = append(cycle, imp.name)
+			}
+			cycle = append(cycle, node.Path.Value)
+			return newError(object.IMPORT_ERROR, "import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return newError(object.IMPORT_ERROR, "could not read module %s: %s", node.Path.Value, err)
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError(object.IMPORT_ERROR, "could not parse module %s: %s", node.Path.Value, strings.Join(p.Errors(), "; "))
+	}
+
+	moduleEnv := object.NewEnvironmentWithBuiltins(e.builtins)
+	moduleEnv.SetModules(modules)
+	moduleEnv.SetCaller(env.Caller())
+	macroEnv := object.NewEnvironmentWithBuiltins(e.builtins)
+
+	e.defineMacros(program, macroEnv)
+	expanded, err := e.expandMacros(program, macroEnv)
+	if err != nil {
+		return newError(object.IMPORT_ERROR, "could not expand macros in module %s: %s", node.Path.Value, err)
+	}
+
+	e.importing = append(e.importing, importing{path: path, name: node.Path.Value})
+	result := e.evalScope(expanded, moduleEnv)
+	e.importing = e.importing[:len(e.importing)-1]
+	if isError(result) {
+		return result
+	}
+
+	module := &object.Module{Name: node.Path.Value, Exports: make(map[string]object.Object)}
+	for _, stmt := range expanded.(*ast.Program).Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			module.Exports[export.Let.Name.Value], _ = moduleEnv.Get(export.Let.Name.Value)
+		}
+	}
+
+	modules[path] = module
+	return module
+}
+
+// findModule returns the absolute path of the module imported as path.
+func (e *evaluator) findModule(path string) (string, bool) {
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		candidates = []string{filepath.Join(e.dir(), path)}
+		for _, dir := range e.modulePaths {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		abs, err := filepath.Abs(candidate)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(abs); err == nil && !info.IsDir() && e.inImportRoot(abs) {
+			return abs, true
+		}
+	}
+
+	return "", false
+}
+
+// inImportRoot reports whether the file at path is in the import root, if
+// there is one.
+func (e *evaluator) inImportRoot(path string) bool {
+	if e.importRoot == "" {
+		return true
+	}
+
+	rel, err := filepath.Rel(e.importRoot, realPath(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// realPath returns path made absolute with its symlinks resolved, or as it
+// is if that fails.
+func realPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	return path
+}
+
+// dir is the directory of the file being evaluated, or "" for the working
+// directory, or the import root for code that didn't come from a file.
+func (e *evaluator) dir() string {
+	if len(e.importing) == 0 {
+		return e.importRoot
+	}
+	return filepath.Dir(e.importing[len(e.importing)-1].path)
+}
+
+func evalMemberExpression(obj object.Object, member string) object.Object {
+	if errValue, ok := obj.(*object.ErrorValue); ok {
+		field, ok := errValue.Field(member)
+		if !ok {
+			return newError(object.NAME_ERROR, "%s has no field: %s", obj.Type(), member)
+		}
+		return field
+	}
+
+	module, ok := obj.(*object.Module)
+	if !ok {
+		return newError(object.TYPE_ERROR, "member access not supported: %s", obj.Type())
+	}
+
+	value, ok := module.Exports[member]
+	if !ok {
+		return newError(object.NAME_ERROR, "module %s has no export: %s", module.Name, member)
+	}
+	return value
+}
+
+// readModuleFile reads the file at path to run as the program's main module.
+func readModuleFile(path string) (string, importing, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", importing{}, err
+	}
+
+	source, err := os.ReadFile(abs)
+	if err != nil {
+		return "", importing{}, err
+	}
+
+	return string(source), importing{path: abs, name: path}, nil
+}
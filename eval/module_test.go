@@ -0,0 +1,175 @@
+package eval
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("could not create %s: %s", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatalf("could not write %s: %s", path, err)
+		}
+	}
+
+	return dir
+}
+
+func TestImports(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"main.mk": `
+import "lib/math.mk" as math;
+import "greet.mk" as greet;
+greet.hello(math.double(21))`,
+		"lib/math.mk": `
+import "helpers.mk" as helpers;
+let twice = fn(x) { helpers.add(x, x) };
+export let double = fn(x) { twice(x) };`,
+		"lib/helpers.mk": `export let add = fn(a, b) { a + b };`,
+		"shared/greet.mk": `
+puts("loading greet");
+export let hello = fn(n) { if (n == 42) { "hello" } else { "bye" } };`,
+	})
+
+	var stdout bytes.Buffer
+	interp := NewInterpreter(Options{Stdout: &stdout, ModulePaths: []string{filepath.Join(dir, "shared")}})
+
+	evaluated, err := interp.RunFile(filepath.Join(dir, "main.mk"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if evaluated.Inspect() != "hello" {
+		t.Errorf("wrong result. want=%q, got=%q", "hello", evaluated.Inspect())
+	}
+
+	// later imports of the same module are served from the cache
+	if _, err := interp.Run(`import "` + filepath.Join(dir, "shared/greet.mk") + `" as again; again.hello(1)`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if stdout.String() != "loading greet\n" {
+		t.Errorf("module evaluated more than once. printed %q", stdout.String())
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.mk":       `import "b.mk" as b; export let a = 1;`,
+		"b.mk":       `import "c.mk" as c; export let b = 2;`,
+		"c.mk":       `import "a.mk" as a; export let c = 3;`,
+		"lib.mk":     `let secret = 1; export let public = 2;`,
+		"broken.mk":  `let = 1;`,
+		"failing.mk": `export let x = 1 + true;`,
+		"nested.mk":  `if (true) { export let x = 1; }`,
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "missing.mk" as m; 1`, "module not found: missing.mk"},
+		{`import "a.mk" as a; a.a`, "import cycle: a.mk -> b.mk -> c.mk -> a.mk"},
+		{`import "lib.mk" as lib; lib.public + lib.secret`, `module lib.mk has no export: secret`},
+		{`import "broken.mk" as b; 1`, "could not parse module broken.mk: expected next token to be 'IDENT'. got='='; no prefix parse function for = found"},
+		{`import "failing.mk" as f; 1`, "type mismatch: INTEGER + BOOLEAN"},
+		{`import "nested.mk" as n; 1`, "export is only allowed at the top level of a module"},
+		{`let x = 1; x.y`, "member access not supported: INTEGER"},
+		{`fn() { export let x = 1; }`, "export is only allowed at the top level of a module"},
+	}
+
+	for _, tt := range tests {
+		interp := NewInterpreter(Options{ModulePaths: []string{dir}})
+		_, err := interp.Run(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	interp := NewInterpreter(Options{})
+	_, err := interp.RunFile(filepath.Join(dir, "c.mk"))
+	expected := "import cycle: " + filepath.Join(dir, "c.mk") + " -> a.mk -> b.mk -> c.mk"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
+
+func TestImportRoot(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"root/main.mk":     `import "lib/util.mk" as util; util.n`,
+		"root/lib/util.mk": `import "../../secret.mk" as s; export let n = 1;`,
+		"root/ok.mk":       `export let n = 2;`,
+		"secret.mk":        `export let n = 3;`,
+		"shared/other.mk":  `export let n = 4;`,
+	})
+	root := filepath.Join(dir, "root")
+	if err := os.Symlink(filepath.Join(dir, "secret.mk"), filepath.Join(root, "link.mk")); err != nil {
+		t.Fatalf("could not create symlink: %s", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "ok.mk" as ok; ok.n`, "2"},
+		{`import "main.mk" as m; m`, "module not found: ../../secret.mk"},
+		{`import "../secret.mk" as s; s.n`, "module not found: ../secret.mk"},
+		{`import "` + filepath.Join(dir, "secret.mk") + `" as s; s.n`, "module not found: " + filepath.Join(dir, "secret.mk")},
+		{`import "link.mk" as s; s.n`, "module not found: link.mk"},
+		{`import "other.mk" as o; o.n`, "module not found: other.mk"},
+	}
+
+	for _, tt := range tests {
+		interp := NewInterpreter(Options{ImportRoot: root, ModulePaths: []string{filepath.Join(dir, "shared")}})
+		evaluated, err := interp.Run(tt.input)
+		if err != nil {
+			if err.Error() != tt.expected {
+				t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	interp := NewInterpreter(Options{NoImports: true, ModulePaths: []string{root}})
+	_, err := interp.Run(`import "ok.mk" as ok; ok.n`)
+	expected := "imports are not allowed: ok.mk"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
+
+func TestModuleValues(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib.mk": `export let n = 1;`,
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib.mk" as lib; lib`, `module("lib.mk")`},
+		{`import "lib.mk" as lib; let f = fn() { lib.n + 1 }; f()`, "2"},
+	}
+
+	for _, tt := range tests {
+		interp := NewInterpreter(Options{ModulePaths: []string{dir}})
+		evaluated, err := interp.Run(tt.input)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.input, err)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
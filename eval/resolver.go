@@ -0,0 +1,342 @@
+package eval
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// Resolve annotates every identifier in program with where its binding lives:
+// how many environments out from the one it's evaluated in, and which slot,
+// or which builtin it names. Top-level bindings are given slots in env so they
+// survive between programs evaluated in the same environment, as in the REPL.
+//
+// Every scope's `let`s are declared up front, so functions can refer to
+// bindings made later in the same scope. Code outside those functions only
+// sees a `let` from where it is onward, so `let s = s + 1` still reads an
+// outer s.
+//
+// Resolve returns an "identifier not found" diagnostic for every name that
+// isn't bound anywhere, without running any code.
+func Resolve(program *ast.Program, env *object.Environment) []string {
+	messages := []string{}
+	for _, err := range resolveProgram(program, env, object.Builtins) {
+		messages = append(messages, err.Message)
+	}
+	return messages
+}
+
+func resolveProgram(program *ast.Program, env *object.Environment, builtins []object.BuiltinDefinition) []*object.Error {
+	r := &resolver{scope: &scope{env: env}, builtins: builtins}
+	r.hoist(program.Statements)
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Let
+		}
+		r.resolve(stmt)
+	}
+	return r.errors
+}
+
+// resolveMacro resolves a macro's body relative to the environment it's
+// defined in. Names that can't be resolved are left for Eval to report when
+// the macro is expanded.
+func resolveMacro(macro *ast.MacroLiteral, env *object.Environment, builtins []object.BuiltinDefinition) {
+	r := &resolver{scope: &scope{env: env}, builtins: builtins}
+	r.resolveFunction(macro.Parameters, macro.Body)
+}
+
+type resolver struct {
+	scope    *scope
+	builtins []object.BuiltinDefinition
+	errors   []*object.Error
+}
+
+// scope mirrors an environment created at runtime: the program's, one per
+// function call, or one per loop iteration. Blocks don't get their own.
+type scope struct {
+	slots    map[string]int
+	env      *object.Environment // set for the outermost scope, whose slots live in env
+	outer    *scope
+	function bool            // set for a function's scope
+	pending  map[string]bool // hoisted names whose `let` isn't reached yet
+}
+
+func (s *scope) declare(name string) int {
+	if s.env != nil {
+		return s.env.Slot(name)
+	}
+	if slot, ok := s.slots[name]; ok {
+		return slot
+	}
+	slot := len(s.slots)
+	s.slots[name] = slot
+	return slot
+}
+
+// hoist declares name ahead of the `let` binding it, unless it's bound
+// already, as by a parameter or an earlier program.
+func (s *scope) hoist(name string) {
+	if _, ok := s.lookup(name); ok {
+		return
+	}
+	if s.pending == nil {
+		s.pending = make(map[string]bool)
+	}
+	s.declare(name)
+	s.pending[name] = true
+}
+
+func (s *scope) lookup(name string) (int, bool) {
+	if s.env != nil {
+		return s.env.Lookup(name)
+	}
+	slot, ok := s.slots[name]
+	return slot, ok
+}
+
+func (r *resolver) push() {
+	r.scope = &scope{slots: make(map[string]int), outer: r.scope}
+}
+
+func (r *resolver) pop() {
+	r.scope = r.scope.outer
+}
+
+// hoist declares every `let` that binds in the current scope, skipping the
+// ones inside functions and loops which get scopes of their own.
+func (r *resolver) hoist(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.FunctionLiteral, *ast.ForExpression, *ast.MacroLiteral:
+				return false
+			case *ast.LetStatement:
+				r.scope.hoist(node.Name.Value)
+			case *ast.ImportStatement:
+				r.scope.hoist(node.Name.Value)
+			case *ast.TryExpression:
+				// the catch block has a scope of its own, for its parameter
+				r.hoist(node.Block.Statements)
+				if node.Finally != nil {
+					r.hoist(node.Finally.Statements)
+				}
+				return false
+			}
+			return true
+		})
+	}
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			r.resolve(stmt)
+		}
+
+	case *ast.LetStatement:
+		r.resolveExpression(node.Value)
+		r.bind(node.Name)
+
+	case *ast.ReturnStatement:
+		r.resolveExpression(node.ReturnValue)
+
+	case *ast.ThrowStatement:
+		r.resolveExpression(node.Value)
+
+	case *ast.ImportStatement:
+		r.bind(node.Name)
+
+	case *ast.ExportStatement:
+		// top-level exports are resolved as plain lets by resolveProgram
+		r.errors = append(r.errors, newError(object.SYNTAX_ERROR, "export is only allowed at the top level of a module"))
+		r.resolve(node.Let)
+
+	case *ast.ExpressionStatement:
+		r.resolveExpression(node.Expression)
+
+	case *ast.Identifier:
+		r.resolveIdentifier(node)
+
+	case *ast.PrefixExpression:
+		r.resolveExpression(node.Right)
+
+	case *ast.InfixExpression:
+		r.resolveExpression(node.Left)
+		r.resolveExpression(node.Right)
+
+	case *ast.IndexExpression:
+		r.resolveExpression(node.Left)
+		r.resolveExpression(node.Index)
+
+	case *ast.MemberExpression:
+		// members are looked up on the object, not in scope
+		r.resolveExpression(node.Object)
+
+	case *ast.ArrayLiteral:
+		for _, elem := range node.Elements {
+			r.resolveExpression(elem)
+		}
+
+	case *ast.SetLiteral:
+		for _, elem := range node.Elements {
+			r.resolveExpression(elem)
+		}
+
+	case *ast.HashLiteral:
+		for _, key := range node.Keys {
+			r.resolveExpression(key)
+			r.resolveExpression(node.Pairs[key])
+		}
+
+	case *ast.IfExpression:
+		r.resolveExpression(node.Condition)
+		r.resolve(node.Consequence)
+		if node.Alternative != nil {
+			r.resolve(node.Alternative)
+		}
+
+	case *ast.ForExpression:
+		r.resolveExpression(node.Iterable)
+		r.push()
+		r.bind(node.Variable)
+		r.hoist(node.Body.Statements)
+		r.resolve(node.Body)
+		r.pop()
+
+	case *ast.TryExpression:
+		r.resolve(node.Block)
+		if node.Catch != nil {
+			r.push()
+			r.bind(node.Parameter)
+			r.hoist(node.Catch.Statements)
+			r.resolve(node.Catch)
+			r.pop()
+		}
+		if node.Finally != nil {
+			r.resolve(node.Finally)
+		}
+
+	case *ast.FunctionLiteral:
+		r.resolveFunction(node.Parameters, node.Body)
+		markTailCalls(node.Body)
+
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			r.resolveQuoted(node.Arguments)
+			return
+		}
+		r.resolveExpression(node.Function)
+		for _, arg := range node.Arguments {
+			r.resolveExpression(arg)
+		}
+	}
+}
+
+func (r *resolver) resolveExpression(expr ast.Expression) {
+	if expr != nil {
+		r.resolve(expr)
+	}
+}
+
+func (r *resolver) resolveFunction(params []*ast.Identifier, body *ast.BlockStatement) {
+	r.push()
+	r.scope.function = true
+	for _, param := range params {
+		r.bind(param)
+	}
+	r.hoist(body.Statements)
+	r.resolve(body)
+	r.pop()
+}
+
+// resolveQuoted only resolves the unquoted parts of quoted code; the rest is
+// data until it's spliced into a program by a macro.
+func (r *resolver) resolveQuoted(args []ast.Expression) {
+	for _, arg := range args {
+		ast.Inspect(arg, func(node ast.Node) bool {
+			if !isUnquoteCall(node) {
+				return true
+			}
+			for _, arg := range node.(*ast.CallExpression).Arguments {
+				r.resolveExpression(arg)
+			}
+			return false
+		})
+	}
+}
+
+func (r *resolver) bind(ident *ast.Identifier) {
+	ident.Kind = ast.Variable
+	ident.Depth = 0
+	ident.Slot = r.scope.declare(ident.Value)
+	delete(r.scope.pending, ident.Value)
+}
+
+func (r *resolver) resolveIdentifier(ident *ast.Identifier) {
+	// a name hoisted but not yet bound is only seen from functions, which
+	// run later; anything else looks past it to an outer binding
+	depth := 0
+	inFunction := false
+	for s := r.scope; s != nil; s = s.outer {
+		if slot, ok := s.lookup(ident.Value); ok && (inFunction || !s.pending[ident.Value]) {
+			ident.Kind = ast.Variable
+			ident.Depth = depth
+			ident.Slot = slot
+			return
+		}
+		inFunction = inFunction || s.function
+		depth++
+	}
+
+	for i, def := range r.builtins {
+		if def.Name == ident.Value {
+			ident.Kind = ast.Builtin
+			ident.Slot = i
+			return
+		}
+	}
+
+	ident.Kind = ast.Unresolved
+	r.errors = append(r.errors, newError(object.NAME_ERROR, "identifier not found: %s", ident.Value))
+}
+
+// markTailCalls flags the calls in body whose result the function returns
+// as-is: the values of return statements and the final expression of the
+// body, looking through ifs. Loops and nested functions are left alone, as are
+// tries, which have to see the errors calls in them end in.
+func markTailCalls(body *ast.BlockStatement) {
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral, *ast.TryExpression:
+			return false
+		case *ast.CallExpression:
+			return node.Function.TokenLiteral() != "quote"
+		case *ast.ReturnStatement:
+			markTailExpression(node.ReturnValue)
+		}
+		return true
+	})
+	markTailBlock(body)
+}
+
+func markTailBlock(block *ast.BlockStatement) {
+	if block == nil || len(block.Statements) == 0 {
+		return
+	}
+	if stmt, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement); ok {
+		markTailExpression(stmt.Expression)
+	}
+}
+
+func markTailExpression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.CallExpression:
+		if expr.Function.TokenLiteral() != "quote" {
+			expr.Tail = true
+		}
+	case *ast.IfExpression:
+		markTailBlock(expr.Consequence)
+		markTailBlock(expr.Alternative)
+	}
+}
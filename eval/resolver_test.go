@@ -0,0 +1,146 @@
+package eval
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	program := testParseProgram(`
+	let a = 1;
+	let f = fn(b) {
+		for (c in [b]) { a + b + c + len([]) }
+	};
+	`)
+
+	env := object.NewEnvironment()
+	if errors := Resolve(program, env); len(errors) != 0 {
+		t.Fatalf("unexpected resolver errors: %v", errors)
+	}
+
+	tests := []struct {
+		name  string
+		kind  ast.IdentifierKind
+		depth int
+		slot  int
+	}{
+		{"a", ast.Variable, 2, 0},
+		{"b", ast.Variable, 1, 0},
+		{"c", ast.Variable, 0, 0},
+		{"len", ast.Builtin, 0, 0},
+	}
+
+	found := map[string]*ast.Identifier{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpression); ok {
+			found["len"] = call.Function.(*ast.Identifier)
+		}
+		if infix, ok := node.(*ast.InfixExpression); ok {
+			if ident, ok := infix.Right.(*ast.Identifier); ok {
+				found[ident.Value] = ident
+			}
+			if ident, ok := infix.Left.(*ast.Identifier); ok {
+				found[ident.Value] = ident
+			}
+		}
+		return true
+	})
+
+	for _, tt := range tests {
+		ident, ok := found[tt.name]
+		if !ok {
+			t.Fatalf("identifier %s not found in program", tt.name)
+		}
+		if ident.Kind != tt.kind || ident.Depth != tt.depth || ident.Slot != tt.slot {
+			t.Errorf("%s resolved wrong. want=(%d, %d, %d), got=(%d, %d, %d)",
+				tt.name, tt.kind, tt.depth, tt.slot, ident.Kind, ident.Depth, ident.Slot)
+		}
+	}
+
+	if slot, ok := env.Lookup("f"); !ok || slot != 1 {
+		t.Errorf("global f has wrong slot. got=%d (%t)", slot, ok)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	program := testParseProgram(`
+	let f = fn() { foo + quote(bar + unquote(baz)) };
+	qux;
+	`)
+
+	errors := Resolve(program, object.NewEnvironment())
+
+	expected := []string{
+		"identifier not found: foo",
+		"identifier not found: baz",
+		"identifier not found: qux",
+	}
+
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d (%v)", len(expected), len(errors), errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("errors[%d] wrong. want=%q, got=%q", i, msg, errors[i])
+		}
+	}
+}
+
+func TestMarkTailCalls(t *testing.T) {
+	program := testParseProgram(`
+	fn(x) {
+		if (x) { return a(x); }
+		for (y in x) { b(y) }
+		c(d(x)) + 1;
+		if (x) { e(x) } else { fn() { f() } }
+	}
+	`)
+	Resolve(program, object.NewEnvironment())
+
+	tail := map[string]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpression); ok {
+			tail[call.Function.String()] = call.Tail
+		}
+		return true
+	})
+
+	expected := map[string]bool{"a": true, "b": false, "c": false, "d": false, "e": true, "f": true}
+	for name, want := range expected {
+		if tail[name] != want {
+			t.Errorf("call to %s has wrong Tail. want=%t, got=%t", name, want, tail[name])
+		}
+	}
+}
+
+func TestResolveKeepsGlobalsBetweenPrograms(t *testing.T) {
+	env := object.NewEnvironment()
+
+	Eval(testParseProgram("let x = 5;"), env)
+	evaluated := Eval(testParseProgram("let f = fn() { x * 2 }; f()"), env)
+
+	testIntegerObject(t, evaluated, 10)
+}
+
+func TestResolveShadowing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let s = 1; let f = fn() { let s = s + 1; s }; f()", 2},
+		{"let s = 1; let xs = []; for (i in 0..3) { let s = s + s; append!(xs, s) }; xs[2]", 2},
+		{"let s = 1; let f = fn(s) { let s = s * 10; s }; f(2) + s", 21},
+		{"let f = fn() { g() }; let g = fn() { n }; let n = 3; f()", 3},
+		{"let len = len([1, 2]); len", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEvaluate(tt.input), tt.expected)
+	}
+
+	errors := Resolve(testParseProgram("let f = fn() { let t = t + 1; t }"), object.NewEnvironment())
+	if len(errors) != 1 || errors[0] != "identifier not found: t" {
+		t.Errorf("wrong resolver errors. got=%v", errors)
+	}
+}
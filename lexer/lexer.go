@@ -7,10 +7,12 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+	line         int
+	column       int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
@@ -19,6 +21,7 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	line, column := l.line, l.column
 
 	switch l.ch {
 	case '=':
@@ -26,6 +29,9 @@ func (l *Lexer) NextToken() token.Token {
 			ch := l.ch
 			l.readChar()
 			tok = token.Token{Type: token.EQUAL, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: "=>"}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -48,7 +54,31 @@ func (l *Lexer) NextToken() token.Token {
 	case '<':
 		tok = newToken(token.LT, l.ch)
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.COMPOSE, Literal: ">>"}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.PIPE, Literal: "|>"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '.':
+		if l.peekChar() == '.' {
+			l.readChar()
+			if l.peekChar() == '=' {
+				l.readChar()
+				tok = token.Token{Type: token.RANGE_INCLUSIVE, Literal: "..="}
+			} else {
+				tok = token.Token{Type: token.RANGE, Literal: ".."}
+			}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
@@ -59,6 +89,13 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
+	case '#':
+		if l.peekChar() == '{' {
+			l.readChar()
+			tok = token.Token{Type: token.SET, Literal: "#{"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
@@ -77,20 +114,29 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Line, tok.Column = line, column
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Literal = l.readNumber()
 			tok.Type = token.INT
+			tok.Line, tok.Column = line, column
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 	l.readChar()
+	tok.Line, tok.Column = line, column
 	return tok
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -108,11 +154,16 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
+// readIdentifier reads an identifier, which may end in a `!` like the
+// builtins that change their arguments, as long as it isn't the start of `!=`.
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 	for isLetter(l.ch) {
 		l.readChar()
 	}
+	if l.ch == '!' && l.peekChar() != '=' {
+		l.readChar()
+	}
 	return l.input[position:l.position]
 }
 
@@ -30,6 +30,16 @@ func TestNextToken(t *testing.T) {
 	"foo bar"
 	[1, 2];
 	{"foo": "bar"}
+	0..10;
+	0..=10;
+	for (i in xs) {}
+	xs |> f >> g
+	(a, b) => a
+	macro(x) { x }
+	import "lib.mk" as lib;
+	export let x = lib.y;
+	#{1, #}
+	append!(xs); a!=b
 	`
 
 	tests := []struct {
@@ -133,6 +143,73 @@ func TestNextToken(t *testing.T) {
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
 
+		{token.INT, "0"},
+		{token.RANGE, ".."},
+		{token.INT, "10"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "0"},
+		{token.RANGE_INCLUSIVE, "..="},
+		{token.INT, "10"},
+		{token.SEMICOLON, ";"},
+
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "i"},
+		{token.IN, "in"},
+		{token.IDENT, "xs"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+
+		{token.IDENT, "xs"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "f"},
+		{token.COMPOSE, ">>"},
+		{token.IDENT, "g"},
+
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.IDENT, "b"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "a"},
+
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.RBRACE, "}"},
+
+		{token.IMPORT, "import"},
+		{token.STRING, "lib.mk"},
+		{token.AS, "as"},
+		{token.IDENT, "lib"},
+		{token.SEMICOLON, ";"},
+		{token.EXPORT, "export"},
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "lib"},
+		{token.DOT, "."},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.SET, "#{"},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.ILLEGAL, "#"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "append!"},
+		{token.LPAREN, "("},
+		{token.IDENT, "xs"},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.NOT_EQUAL, "!="},
+		{token.IDENT, "b"},
+
 		{token.EOF, ""},
 		{token.EOF, ""},
 	}
@@ -151,3 +228,41 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  add(x, "a b")`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"add", 2, 3},
+		{"(", 2, 6},
+		{"x", 2, 7},
+		{",", 2, 8},
+		{"a b", 2, 10},
+		{")", 2, 15},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected %d:%d, got %d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
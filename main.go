@@ -1,18 +1,41 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"monkey/eval"
+	"monkey/object"
 	"monkey/repl"
 	"os"
 	"os/user"
+	"path/filepath"
 )
 
+var engine = flag.String("engine", repl.EngineEval, "use 'eval' or 'vm'")
+
 func main() {
+	flag.Parse()
+
+	// `monkey script.mk` runs the script, looking for its imports in
+	// $MONKEYPATH too
+	if flag.NArg() > 0 {
+		interp := eval.NewInterpreter(eval.Options{ModulePaths: filepath.SplitList(os.Getenv("MONKEYPATH"))})
+		if _, err := interp.RunFile(flag.Arg(0)); err != nil {
+			if monkeyErr, ok := err.(*object.Error); ok {
+				fmt.Fprintln(os.Stderr, monkeyErr.Inspect())
+			} else {
+				fmt.Fprintln(os.Stderr, "ERROR: "+err.Error())
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
 	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	repl.Start(os.Stdin, os.Stdout, *engine)
 }
@@ -0,0 +1,796 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"monkey/token"
+	"os"
+	"strings"
+)
+
+// VariadicArity is the Arity of builtins taking any number of arguments.
+const VariadicArity = -1
+
+type BuiltinDefinition struct {
+	Name    string
+	Builtin *Builtin
+	Arity   int    // or VariadicArity
+	Doc     string // for people looking the builtin up
+
+	// Methods are the types the builtin can also be called on as a method,
+	// with the value it's called on passed first, so `xs.push(x)` is
+	// `push(xs, x)`.
+	Methods []ObjectType
+}
+
+// Builtins is shared by the evaluator and the compiler/vm, doing I/O on the
+// process's standard streams. The compiler refers to builtins by their index
+// in this slice, so new entries go at the end.
+var Builtins = NewBuiltins(os.Stdin, os.Stdout, os.Stderr)
+
+// registered holds the builtins added with RegisterBuiltin.
+var registered []BuiltinDefinition
+
+// RegisterBuiltin adds def to Builtins and to every set of builtins made by
+// NewBuiltins afterwards, replacing any builtin of the same name. It's meant to
+// be called from init functions, before anything is compiled or evaluated.
+func RegisterBuiltin(def BuiltinDefinition) error {
+	defs, err := WithBuiltin(Builtins, def)
+	if err != nil {
+		return err
+	}
+
+	Builtins = defs
+	registered = append(registered, def)
+	return nil
+}
+
+// WithBuiltin returns a copy of defs with def added, or in place of the builtin
+// of the same name. Unless def is variadic, the number of arguments it's called
+// with is checked before its function is.
+func WithBuiltin(defs []BuiltinDefinition, def BuiltinDefinition) ([]BuiltinDefinition, error) {
+	if !isIdentifier(def.Name) {
+		return nil, fmt.Errorf("invalid builtin name: %q", def.Name)
+	}
+	if def.Builtin == nil || (def.Builtin.Fn == nil && def.Builtin.CallingFn == nil) {
+		return nil, fmt.Errorf("builtin `%s` has no function", def.Name)
+	}
+	if def.Arity < VariadicArity {
+		return nil, fmt.Errorf("builtin `%s` has invalid arity %d", def.Name, def.Arity)
+	}
+	if def.Builtin.Fn == nil {
+		size := def.Builtin.Size
+		def.Builtin = NewCallingBuiltin(def.Builtin.CallingFn)
+		def.Builtin.Size = size
+	}
+
+	if def.Arity != VariadicArity {
+		builtin, arity := def.Builtin, def.Arity
+		def.Builtin = NewCallingBuiltin(func(call Caller, args ...Object) Object {
+			if len(args) != arity {
+				return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=%d", len(args), arity)
+			}
+			return builtin.Call(call, args...)
+		})
+		def.Builtin.Size = builtin.Size
+	}
+
+	withDef := append([]BuiltinDefinition{}, defs...)
+	for i := range withDef {
+		if withDef[i].Name == def.Name {
+			withDef[i] = def
+			return withDef, nil
+		}
+	}
+	return append(withDef, def), nil
+}
+
+// MethodTable sorts the builtins in defs that can be called as methods by the
+// types they can be called on.
+func MethodTable(defs []BuiltinDefinition) map[ObjectType]map[string]*Builtin {
+	methods := make(map[ObjectType]map[string]*Builtin)
+	for _, def := range defs {
+		for _, t := range def.Methods {
+			if methods[t] == nil {
+				methods[t] = make(map[string]*Builtin)
+			}
+			methods[t][def.Name] = def.Builtin
+		}
+	}
+	return methods
+}
+
+func isIdentifier(name string) bool {
+	if name == "" || token.LookupIdent(name) != token.IDENT {
+		return false
+	}
+	for i, ch := range name {
+		if ch == '!' && i > 0 && i == len(name)-1 {
+			continue
+		}
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// NewBuiltins returns the builtins in the same order as Builtins, with puts,
+// eputs and gets using the given streams.
+func NewBuiltins(stdin io.Reader, stdout io.Writer, stderr io.Writer) []BuiltinDefinition {
+	defs := standardBuiltins(stdin, stdout, stderr)
+	for _, def := range registered {
+		defs, _ = WithBuiltin(defs, def)
+	}
+	return defs
+}
+
+// Most builtins leave their arguments alone and return new values, like set
+// and delete; the ones ending in `!`, like set! and delete!, change their
+// first argument in place instead. Arrays and hashes are persistent, so new
+// ones share what they can with the old without either seeing changes to the
+// other, and set and delete take O(log n). Their elements aren't copied
+// though: an array or hash holds the very values put in it, so set! on one of
+// those shows wherever it's held. Only arrays, hashes and sets used as hash
+// keys or set elements are copied.
+func standardBuiltins(stdin io.Reader, stdout io.Writer, stderr io.Writer) []BuiltinDefinition {
+	return []BuiltinDefinition{
+		{
+			Name:    "len",
+			Arity:   1,
+			Doc:     "len(x) returns the number of elements in an array, range or set, or bytes in a string.",
+			Methods: []ObjectType{STRING_OBJ, ARRAY_OBJ, RANGE_OBJ, SET_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					return &Integer{Value: int64(arg.Len())}
+				case *String:
+					return &Integer{Value: int64(len(arg.Value))}
+				case *Range:
+					return &Integer{Value: arg.Len()}
+				case *Set:
+					return &Integer{Value: int64(arg.Len())}
+				default:
+					return newError(TYPE_ERROR, "argument type given to `len` not supported, got=%s", args[0].Type())
+				}
+			}},
+		},
+		{
+			Name:    "first",
+			Arity:   1,
+			Doc:     "first(xs) returns the first element of an array, or null if it is empty.",
+			Methods: []ObjectType{ARRAY_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					if first, ok := arg.At(0); ok {
+						return first
+					}
+					return NULL
+				default:
+					return newError(TYPE_ERROR, "argument type given to `first` not supported, got=%s", args[0].Type())
+				}
+			}, Size: sizeNothing},
+		},
+		{
+			Name:    "last",
+			Arity:   1,
+			Doc:     "last(xs) returns the last element of an array, or null if it is empty.",
+			Methods: []ObjectType{ARRAY_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					if last, ok := arg.At(arg.Len() - 1); ok {
+						return last
+					}
+					return NULL
+				default:
+					return newError(TYPE_ERROR, "argument type given to `last` not supported, got=%s", args[0].Type())
+				}
+			}, Size: sizeNothing},
+		},
+		{
+			Name:    "rest",
+			Arity:   1,
+			Doc:     "rest(xs) returns a new array of all but the first element of xs.",
+			Methods: []ObjectType{ARRAY_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					if arg.Len() > 0 {
+						return arg.Rest()
+					}
+					return NULL
+				default:
+					return newError(TYPE_ERROR, "argument type given to `rest` not supported, got=%s", args[0].Type())
+				}
+			}, Size: sizeRest},
+		},
+		{
+			Name:    "push",
+			Arity:   2,
+			Doc:     "push(xs, x) returns a new array of the elements of xs followed by x.",
+			Methods: []ObjectType{ARRAY_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=2", len(args))
+				}
+
+				switch first := args[0].(type) {
+				case *Array:
+					return first.Push(args[1])
+				default:
+					return newError(TYPE_ERROR, "argument type given to `push` not supported, got=%s", args[0].Type())
+				}
+			}, Size: sizePush},
+		},
+		{
+			Name:  "puts",
+			Arity: VariadicArity,
+			Doc:   "puts(...) prints each argument on its own line.",
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				for _, arg := range args {
+					fmt.Fprintln(stdout, arg.Inspect())
+				}
+				return NULL
+			}},
+		},
+		{
+			Name:  "array",
+			Arity: 1,
+			Doc:   "array(xs) collects the elements of anything iterable into an array.",
+			Builtin: &Builtin{
+				Fn: func(args ...Object) Object {
+					if len(args) != 1 {
+						return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=1", len(args))
+					}
+
+					iter, ok := NewIterator(args[0])
+					if !ok {
+						return newError(TYPE_ERROR, "argument type given to `array` not supported, got=%s", args[0].Type())
+					}
+
+					elems := []Object{}
+					for elem, ok := iter.Next(); ok; elem, ok = iter.Next() {
+						elems = append(elems, elem)
+					}
+					return NewArray(elems)
+				},
+				// a range takes no memory however long it is, unlike its array
+				Size: func(args ...Object) int64 {
+					if len(args) != 1 {
+						return 0
+					}
+					switch arg := args[0].(type) {
+					case *Range:
+						return arraySize(arg.Len())
+					case *Array:
+						return arraySize(int64(arg.Len()))
+					case *Hash:
+						return arraySize(int64(arg.Len()))
+					case *Set:
+						return arraySize(int64(arg.Len()))
+					default:
+						return 0
+					}
+				},
+			},
+		},
+		{
+			Name:  "error_trace",
+			Arity: 1,
+			Doc:   "error_trace(err) returns the calls err passed through, innermost first.",
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch err := args[0].(type) {
+				case *Error:
+					return traceArray(err)
+				case *ErrorValue:
+					return traceArray(err.Error)
+				default:
+					return newError(TYPE_ERROR, "argument to `error_trace` must be ERROR, got=%s", args[0].Type())
+				}
+			}},
+		},
+		{
+			Name:  "eputs",
+			Arity: VariadicArity,
+			Doc:   "eputs(...) prints each argument on its own line to standard error.",
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				for _, arg := range args {
+					fmt.Fprintln(stderr, arg.Inspect())
+				}
+				return NULL
+			}},
+		},
+		{
+			Name:  "gets",
+			Arity: 0,
+			Doc:   "gets() reads a line from standard input, or returns null at the end of it.",
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 0 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=0", len(args))
+				}
+
+				line, err := readLine(stdin)
+				if err != nil && line == "" {
+					return NULL
+				}
+				return &String{Value: line}
+			}},
+		},
+		{
+			Name:  "error",
+			Arity: VariadicArity,
+			Doc:   "error(kind, message, cause) makes an error value to throw, wrapping cause if given.",
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 2 && len(args) != 3 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=2 or 3", len(args))
+				}
+
+				kind, ok := args[0].(*String)
+				if !ok {
+					return newError(TYPE_ERROR, "first argument to `error` must be STRING, got=%s", args[0].Type())
+				}
+				message, ok := args[1].(*String)
+				if !ok {
+					return newError(TYPE_ERROR, "second argument to `error` must be STRING, got=%s", args[1].Type())
+				}
+
+				err := &Error{Kind: kind.Value, Message: message.Value}
+				if len(args) == 3 && args[2] != NULL {
+					cause, ok := args[2].(*ErrorValue)
+					if !ok {
+						return newError(TYPE_ERROR, "third argument to `error` must be ERROR_VALUE, got=%s", args[2].Type())
+					}
+					err.Cause = cause.Error
+				}
+				return &ErrorValue{Error: err}
+			}},
+		},
+		{
+			Name:  "is_error",
+			Arity: VariadicArity,
+			Doc:   "is_error(x, kind) reports whether x is an error, of kind or wrapping one of kind if given.",
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=1 or 2", len(args))
+				}
+
+				err, ok := args[0].(*ErrorValue)
+				if len(args) == 1 || !ok {
+					return nativeBool(ok)
+				}
+
+				kind, ok := args[1].(*String)
+				if !ok {
+					return newError(TYPE_ERROR, "second argument to `is_error` must be STRING, got=%s", args[1].Type())
+				}
+				return nativeBool(err.Error.HasKind(kind.Value))
+			}},
+		},
+		{
+			Name:  "unwrap",
+			Arity: 1,
+			Doc:   "unwrap(err) returns the error err wraps, or null.",
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				err, ok := args[0].(*ErrorValue)
+				if !ok {
+					return newError(TYPE_ERROR, "argument to `unwrap` must be ERROR_VALUE, got=%s", args[0].Type())
+				}
+				cause, _ := err.Field("cause")
+				return cause
+			}},
+		},
+		{
+			Name:    "keys",
+			Arity:   1,
+			Doc:     "keys(h) returns an array of the keys of a hash, in the order they were set, or the field names of an error value.",
+			Methods: []ObjectType{HASH_OBJ, ERROR_VALUE_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Hash:
+					return NewArray(arg.Keys())
+				case *ErrorValue:
+					return NewArray(arg.Keys())
+				default:
+					return newError(TYPE_ERROR, "argument type given to `keys` not supported, got=%s", args[0].Type())
+				}
+			}},
+		},
+		{
+			Name:    "values",
+			Arity:   1,
+			Doc:     "values(h) returns an array of the values of a hash, in the order their keys were set, or the fields of an error value.",
+			Methods: []ObjectType{HASH_OBJ, ERROR_VALUE_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Hash:
+					return NewArray(arg.Values())
+				case *ErrorValue:
+					return NewArray(arg.Values())
+				default:
+					return newError(TYPE_ERROR, "argument type given to `values` not supported, got=%s", args[0].Type())
+				}
+			}},
+		},
+		{
+			Name:    "union",
+			Arity:   2,
+			Doc:     "union(a, b) returns a new set of the elements of a followed by those of b.",
+			Methods: []ObjectType{SET_OBJ},
+			Builtin: setOperation("union", (*Set).Union),
+		},
+		{
+			Name:    "intersection",
+			Arity:   2,
+			Doc:     "intersection(a, b) returns a new set of the elements of a that are also in b.",
+			Methods: []ObjectType{SET_OBJ},
+			Builtin: setOperation("intersection", (*Set).Intersection),
+		},
+		{
+			Name:    "difference",
+			Arity:   2,
+			Doc:     "difference(a, b) returns a new set of the elements of a that aren't in b.",
+			Methods: []ObjectType{SET_OBJ},
+			Builtin: setOperation("difference", (*Set).Difference),
+		},
+		{
+			Name:    "append!",
+			Arity:   2,
+			Doc:     "append!(xs, x) adds x to the end of the array xs in place and returns xs.",
+			Methods: []ObjectType{ARRAY_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=2", len(args))
+				}
+
+				switch first := args[0].(type) {
+				case *Array:
+					first.Append(args[1])
+					return first
+				default:
+					return newError(TYPE_ERROR, "argument type given to `append!` not supported, got=%s", args[0].Type())
+				}
+			}},
+		},
+		{
+			Name:    "set!",
+			Arity:   3,
+			Doc:     "set!(xs, key, x) puts x at index key of an array or key of a hash in place and returns xs.",
+			Methods: []ObjectType{ARRAY_OBJ, HASH_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 3 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=3", len(args))
+				}
+
+				switch first := args[0].(type) {
+				case *Array:
+					index, ok := args[1].(*Integer)
+					if !ok {
+						return newError(TYPE_ERROR, "index given to `set!` must be INTEGER, got=%s", args[1].Type())
+					}
+					if index.Value < 0 || index.Value >= int64(first.Len()) {
+						return newError(VALUE_ERROR, "index out of range: %d", index.Value)
+					}
+					first.Set(int(index.Value), args[2])
+					return first
+				case *Hash:
+					if !first.Set(args[1], args[2]) {
+						return newError(TYPE_ERROR, "unusable type given as hash key: %s", args[1].Type())
+					}
+					return first
+				default:
+					return newError(TYPE_ERROR, "argument type given to `set!` not supported, got=%s", args[0].Type())
+				}
+			}},
+		},
+		{
+			Name:    "delete!",
+			Arity:   2,
+			Doc:     "delete!(h, key) removes key from the hash h in place and returns h.",
+			Methods: []ObjectType{HASH_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=2", len(args))
+				}
+
+				switch first := args[0].(type) {
+				case *Hash:
+					if _, ok := HashKeyOf(args[1]); !ok {
+						return newError(TYPE_ERROR, "unusable type given as hash key: %s", args[1].Type())
+					}
+					first.Delete(args[1])
+					return first
+				default:
+					return newError(TYPE_ERROR, "argument type given to `delete!` not supported, got=%s", args[0].Type())
+				}
+			}},
+		},
+		{
+			Name:    "pop!",
+			Arity:   1,
+			Doc:     "pop!(xs) removes the last element of the array xs in place and returns it, or null if xs is empty.",
+			Methods: []ObjectType{ARRAY_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					if last, ok := arg.Pop(); ok {
+						return last
+					}
+					return NULL
+				default:
+					return newError(TYPE_ERROR, "argument type given to `pop!` not supported, got=%s", args[0].Type())
+				}
+			}},
+		},
+		{
+			Name:    "upper",
+			Arity:   1,
+			Doc:     "upper(s) returns s with its letters in upper case.",
+			Methods: []ObjectType{STRING_OBJ},
+			Builtin: stringOperation("upper", strings.ToUpper),
+		},
+		{
+			Name:    "lower",
+			Arity:   1,
+			Doc:     "lower(s) returns s with its letters in lower case.",
+			Methods: []ObjectType{STRING_OBJ},
+			Builtin: stringOperation("lower", strings.ToLower),
+		},
+		{
+			Name:    "map",
+			Arity:   2,
+			Doc:     "map(xs, f) returns a new array of the results of calling f with each element of xs.",
+			Methods: []ObjectType{ARRAY_OBJ},
+			Builtin: NewCallingBuiltin(func(call Caller, args ...Object) Object {
+				if len(args) != 2 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=2", len(args))
+				}
+
+				xs, ok := args[0].(*Array)
+				if !ok {
+					return newError(TYPE_ERROR, "argument type given to `map` not supported, got=%s", args[0].Type())
+				}
+
+				mapped := NewArray(nil)
+				for _, elem := range xs.Elements() {
+					result := call(args[1], elem)
+					if _, ok := result.(*Error); ok {
+						return result
+					}
+					mapped.Append(result)
+				}
+				return mapped
+			}),
+		},
+		{
+			Name:    "filter",
+			Arity:   2,
+			Doc:     "filter(xs, f) returns a new array of the elements of xs that f returns something truthy for.",
+			Methods: []ObjectType{ARRAY_OBJ},
+			Builtin: NewCallingBuiltin(func(call Caller, args ...Object) Object {
+				if len(args) != 2 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=2", len(args))
+				}
+
+				xs, ok := args[0].(*Array)
+				if !ok {
+					return newError(TYPE_ERROR, "argument type given to `filter` not supported, got=%s", args[0].Type())
+				}
+
+				filtered := NewArray(nil)
+				for _, elem := range xs.Elements() {
+					result := call(args[1], elem)
+					if _, ok := result.(*Error); ok {
+						return result
+					}
+					if result != NULL && result != FALSE {
+						filtered.Append(elem)
+					}
+				}
+				return filtered
+			}),
+		},
+		{
+			Name:    "set",
+			Arity:   3,
+			Doc:     "set(xs, key, x) returns a new array or hash like xs but with x at index or key key.",
+			Methods: []ObjectType{ARRAY_OBJ, HASH_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 3 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=3", len(args))
+				}
+
+				switch first := args[0].(type) {
+				case *Array:
+					index, ok := args[1].(*Integer)
+					if !ok {
+						return newError(TYPE_ERROR, "index given to `set` must be INTEGER, got=%s", args[1].Type())
+					}
+					if index.Value < 0 || index.Value >= int64(first.Len()) {
+						return newError(VALUE_ERROR, "index out of range: %d", index.Value)
+					}
+					return first.With(int(index.Value), args[2])
+				case *Hash:
+					with, ok := first.With(args[1], args[2])
+					if !ok {
+						return newError(TYPE_ERROR, "unusable type given as hash key: %s", args[1].Type())
+					}
+					return with
+				default:
+					return newError(TYPE_ERROR, "argument type given to `set` not supported, got=%s", args[0].Type())
+				}
+			}, Size: sizeUpdate},
+		},
+		{
+			Name:    "delete",
+			Arity:   2,
+			Doc:     "delete(h, key) returns a new hash like h but without key.",
+			Methods: []ObjectType{HASH_OBJ},
+			Builtin: &Builtin{Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=2", len(args))
+				}
+
+				switch first := args[0].(type) {
+				case *Hash:
+					if _, ok := HashKeyOf(args[1]); !ok {
+						return newError(TYPE_ERROR, "unusable type given as hash key: %s", args[1].Type())
+					}
+					return first.Without(args[1])
+				default:
+					return newError(TYPE_ERROR, "argument type given to `delete` not supported, got=%s", args[0].Type())
+				}
+			}, Size: sizeUpdate},
+		},
+	}
+}
+
+// setOperation makes the builtin called name that applies op to two sets.
+// sizeNothing is the Size of builtins that return part of what they're
+// given, such as an element of an array.
+func sizeNothing(args ...Object) int64 { return 0 }
+
+// sizeRest is the Size of rest, which returns a new array sharing all of
+// the old one's elements.
+func sizeRest(args ...Object) int64 { return arraySize(0) }
+
+// sizePush is the Size of push, which shares all of the old array but the
+// end of its trie, copying the last leaf and the few branches above it.
+func sizePush(args ...Object) int64 {
+	if len(args) == 0 {
+		return 0
+	}
+	if arr, ok := args[0].(*Array); ok {
+		return arraySize(int64(arr.Len()%vectorWidth) + 1)
+	}
+	return 0
+}
+
+// sizeUpdate is the Size of set and delete, which share all of the old array
+// or hash but the leaf they change and the few branches above it.
+func sizeUpdate(args ...Object) int64 {
+	if len(args) == 0 {
+		return 0
+	}
+	switch arg := args[0].(type) {
+	case *Array:
+		return arraySize(int64(min(arg.Len(), vectorWidth)))
+	case *Hash:
+		return 48 + 64*int64(min(arg.Len()+1, vectorWidth))
+	default:
+		return 0
+	}
+}
+
+// setOperation makes the builtin called name that applies op to two sets.
+func setOperation(name string, op func(a, b *Set) *Set) *Builtin {
+	return &Builtin{Fn: func(args ...Object) Object {
+		if len(args) != 2 {
+			return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=2", len(args))
+		}
+
+		a, ok := args[0].(*Set)
+		if !ok {
+			return newError(TYPE_ERROR, "first argument to `%s` must be SET, got=%s", name, args[0].Type())
+		}
+		b, ok := args[1].(*Set)
+		if !ok {
+			return newError(TYPE_ERROR, "second argument to `%s` must be SET, got=%s", name, args[1].Type())
+		}
+		return op(a, b)
+	}}
+}
+
+// stringOperation makes the builtin called name that applies op to a string.
+func stringOperation(name string, op func(string) string) *Builtin {
+	return &Builtin{Fn: func(args ...Object) Object {
+		if len(args) != 1 {
+			return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected=1", len(args))
+		}
+
+		arg, ok := args[0].(*String)
+		if !ok {
+			return newError(TYPE_ERROR, "argument type given to `%s` not supported, got=%s", name, args[0].Type())
+		}
+		return &String{Value: op(arg.Value)}
+	}}
+}
+
+// readLine reads up to the next newline a byte at a time, so nothing past the
+// line is taken from r, which may be shared with others (like the REPL).
+func readLine(r io.Reader) (string, error) {
+	line := []byte{}
+	b := make([]byte, 1)
+
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, b[0])
+		}
+		if err != nil {
+			return string(line), err
+		}
+	}
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+func newError(kind string, format string, a ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// traceArray lists the frames of err's trace as strings.
+func traceArray(err *Error) *Array {
+	frames := make([]Object, len(err.Trace))
+	for i, frame := range err.Trace {
+		frames[i] = &String{Value: frame.String()}
+	}
+	return NewArray(frames)
+}
@@ -0,0 +1,102 @@
+package object
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWithBuiltin(t *testing.T) {
+	answer := &Builtin{Fn: func(args ...Object) Object { return &Integer{Value: 42} }}
+	defs := []BuiltinDefinition{{Name: "len", Builtin: answer, Arity: 1}}
+
+	added, err := WithBuiltin(defs, BuiltinDefinition{Name: "answer", Builtin: answer, Arity: 0, Doc: "answer() is 42."})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(defs) != 1 || len(added) != 2 || added[1].Name != "answer" || added[1].Doc != "answer() is 42." {
+		t.Fatalf("builtin not added to a copy. got=%+v", added)
+	}
+
+	result := added[1].Builtin.Fn(TRUE)
+	if errObj, ok := result.(*Error); !ok || errObj.Message != "wrong number of arguments. got=1, expected=0" {
+		t.Errorf("arity not checked. got=%+v", result)
+	}
+
+	if _, err := WithBuiltin(defs, BuiltinDefinition{Name: "reset!", Builtin: answer}); err != nil {
+		t.Errorf("name ending in ! not allowed: %s", err)
+	}
+
+	replaced, _ := WithBuiltin(added, BuiltinDefinition{Name: "len", Builtin: answer, Arity: VariadicArity})
+	if len(replaced) != 2 || replaced[0].Builtin != answer {
+		t.Errorf("builtin not replaced in place. got=%+v", replaced)
+	}
+
+	invalid := []struct {
+		def      BuiltinDefinition
+		expected string
+	}{
+		{BuiltinDefinition{Name: "", Builtin: answer}, `invalid builtin name: ""`},
+		{BuiltinDefinition{Name: "fn", Builtin: answer}, `invalid builtin name: "fn"`},
+		{BuiltinDefinition{Name: "a-b", Builtin: answer}, `invalid builtin name: "a-b"`},
+		{BuiltinDefinition{Name: "!", Builtin: answer}, `invalid builtin name: "!"`},
+		{BuiltinDefinition{Name: "a!b", Builtin: answer}, `invalid builtin name: "a!b"`},
+		{BuiltinDefinition{Name: "a!!", Builtin: answer}, `invalid builtin name: "a!!"`},
+		{BuiltinDefinition{Name: "a"}, "builtin `a` has no function"},
+		{BuiltinDefinition{Name: "a", Builtin: answer, Arity: -2}, "builtin `a` has invalid arity -2"},
+	}
+
+	for _, tt := range invalid {
+		_, err := WithBuiltin(defs, tt.def)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	shout, _ := FuncBuiltin("shout", "shout(s) adds an exclamation mark to s.", func(s string) string { return s + "!" })
+	count := len(Builtins)
+
+	if err := RegisterBuiltin(shout); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(Builtins) != count+1 || GetBuiltinByName("shout") == nil {
+		t.Errorf("builtin not added to Builtins")
+	}
+
+	defs := NewBuiltins(nil, nil, nil)
+	if len(defs) != count+1 || defs[count].Name != "shout" {
+		t.Errorf("builtin not added to new builtins")
+	}
+}
+
+// BenchmarkSet shows set taking about as long on a big hash as on a small
+// one, unlike copying the hash to change it, which takes longer the bigger
+// the hash is.
+func BenchmarkSet(b *testing.B) {
+	set := GetBuiltinByName("set")
+	key := &Integer{Value: 0}
+
+	for _, size := range []int{100, 1000} {
+		hash := NewHash()
+		for i := 0; i < size; i++ {
+			hash.Set(&Integer{Value: int64(i)}, TRUE)
+		}
+
+		b.Run(fmt.Sprintf("set/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				set.Fn(hash, key, FALSE)
+			}
+		})
+		b.Run(fmt.Sprintf("copy/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copied := NewHash()
+				for _, pair := range hash.Pairs() {
+					copied.Set(pair.Key, pair.Value)
+				}
+				copied.Set(key, FALSE)
+			}
+		})
+	}
+}
@@ -0,0 +1,601 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"runtime"
+	"sort"
+)
+
+// Apply calls a Monkey function on behalf of Go code, such as a func made by
+// ToGo. Package eval sets it, since only it knows how to run one.
+var Apply func(fn Object, args ...Object) Object
+
+// callFromGo is the Caller for builtins called from Go rather than by an
+// engine.
+func callFromGo(fn Object, args ...Object) Object {
+	switch fn := fn.(type) {
+	case *Builtin:
+		return fn.Call(callFromGo, args...)
+	case *Function:
+		if Apply == nil {
+			return newError(DefaultErrorKind, "functions can only be called from Go once package eval is loaded")
+		}
+		return Apply(fn, args...)
+	default:
+		return newError(TYPE_ERROR, "not a function: %s", fn.Type())
+	}
+}
+
+// FromGo converts a Go value to a Monkey one. Strings, bools and numbers
+// convert to their Monkey counterparts (floats only if they're whole), nil to
+// null, slices and arrays to arrays, and maps to hashes. Structs become hashes
+// keyed by field name, or by the name in a `monkey:"name"` tag; fields tagged
+// `monkey:"-"` are left out. Functions become builtins, as with FuncBuiltin.
+// Pointers and interfaces convert to what they point to, and Objects are
+// returned as they are.
+func FromGo(value interface{}) (Object, error) {
+	return fromGo(reflect.ValueOf(value), "value", map[uintptr]bool{})
+}
+
+// ToGo converts obj into the Go value target points to, the reverse of
+// FromGo. Into an interface{}, integers become int64, arrays []interface{},
+// and hashes map[string]interface{}, or map[interface{}]interface{} if they
+// have keys that aren't strings. Functions and builtins convert to Go funcs,
+// which return Monkey errors as their error result if they have one and panic
+// with them, as *Error, otherwise. Builtins made by FuncBuiltin recover those
+// panics, returning the error instead.
+func ToGo(obj Object, target interface{}) error {
+	ptr := reflect.ValueOf(target)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return fmt.Errorf("target must be a non-nil pointer, got %T", target)
+	}
+
+	value, err := toGo(obj, ptr.Type().Elem(), "value")
+	if err != nil {
+		return err
+	}
+
+	ptr.Elem().Set(value)
+	return nil
+}
+
+func fromGo(value reflect.Value, path string, seen map[uintptr]bool) (Object, error) {
+	if !value.IsValid() {
+		return NULL, nil
+	}
+
+	if value.Type().Implements(objectType) {
+		if isNil(value) {
+			return NULL, nil
+		}
+		return value.Interface().(Object), nil
+	}
+
+	switch value.Kind() {
+	case reflect.Interface:
+		return fromGo(value.Elem(), path, seen)
+
+	case reflect.Ptr:
+		if value.IsNil() {
+			return NULL, nil
+		}
+		if seen[value.Pointer()] {
+			return nil, newError(VALUE_ERROR, "%s is cyclic", path)
+		}
+		seen[value.Pointer()] = true
+		defer delete(seen, value.Pointer())
+		return fromGo(value.Elem(), path, seen)
+
+	case reflect.String:
+		return &String{Value: value.String()}, nil
+
+	case reflect.Bool:
+		return nativeBool(value.Bool()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: value.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value.Uint() > math.MaxInt64 {
+			return nil, newError(VALUE_ERROR, "%s is out of range for INTEGER, got=%d", path, value.Uint())
+		}
+		return &Integer{Value: int64(value.Uint())}, nil
+
+	case reflect.Float32, reflect.Float64:
+		f := value.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, newError(VALUE_ERROR, "%s is not a whole number, got=%v", path, f)
+		}
+		return &Integer{Value: int64(f)}, nil
+
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.Len() > 0 {
+			if seen[value.Pointer()] {
+				return nil, newError(VALUE_ERROR, "%s is cyclic", path)
+			}
+			seen[value.Pointer()] = true
+			defer delete(seen, value.Pointer())
+		}
+
+		elements := make([]Object, value.Len())
+		for i := range elements {
+			elem, err := fromGo(value.Index(i), fmt.Sprintf("%s[%d]", path, i), seen)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = elem
+		}
+		return NewArray(elements), nil
+
+	case reflect.Map:
+		if value.Len() > 0 {
+			if seen[value.Pointer()] {
+				return nil, newError(VALUE_ERROR, "%s is cyclic", path)
+			}
+			seen[value.Pointer()] = true
+			defer delete(seen, value.Pointer())
+		}
+
+		// Go maps are unordered, so sort the keys to make the hash the same
+		// every time
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return lessMapKey(keys[i], keys[j]) })
+
+		hash := NewHash()
+		for _, mapKey := range keys {
+			key, err := fromGo(mapKey, path+" key", seen)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := HashKeyOf(key); !ok {
+				return nil, newError(TYPE_ERROR, "%s key is unusable as hash key: %s", path, key.Type())
+			}
+
+			elem, err := fromGo(value.MapIndex(mapKey), fmt.Sprintf("%s[%s]", path, key.Inspect()), seen)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(key, elem)
+		}
+		return hash, nil
+
+	case reflect.Struct:
+		hash := NewHash()
+		for _, field := range structFields(value.Type()) {
+			elem, err := fromGo(value.FieldByIndex(field.index), path+"."+field.name, seen)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(&String{Value: field.name}, elem)
+		}
+		return hash, nil
+
+	case reflect.Func:
+		if value.IsNil() {
+			return NULL, nil
+		}
+		def, err := FuncBuiltin(runtime.FuncForPC(value.Pointer()).Name(), "", value.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return def.Builtin, nil
+
+	default:
+		return nil, newError(TYPE_ERROR, "%s has unsupported type %s", path, value.Type())
+	}
+}
+
+func toGo(obj Object, t reflect.Type, path string) (reflect.Value, error) {
+	value := reflect.New(t).Elem()
+
+	if t.Implements(objectType) {
+		if !reflect.TypeOf(obj).AssignableTo(t) {
+			return value, mismatch(path, objectTypeOf(t), obj)
+		}
+		value.Set(reflect.ValueOf(obj))
+		return value, nil
+	}
+
+	if obj == NULL {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map, reflect.Func:
+			return value, nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return value, newError(TYPE_ERROR, "%s has unsupported type %s", path, t)
+		}
+		natural, err := toNatural(obj, path)
+		if err != nil {
+			return value, err
+		}
+		if natural != nil {
+			value.Set(reflect.ValueOf(natural))
+		}
+
+	case reflect.String:
+		str, ok := obj.(*String)
+		if !ok {
+			return value, mismatch(path, STRING_OBJ, obj)
+		}
+		value.SetString(str.Value)
+
+	case reflect.Bool:
+		boolean, ok := obj.(*Boolean)
+		if !ok {
+			return value, mismatch(path, BOOLEAN_OBJ, obj)
+		}
+		value.SetBool(boolean.Value)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*Integer)
+		if !ok {
+			return value, mismatch(path, INTEGER_OBJ, obj)
+		}
+		if value.OverflowInt(integer.Value) {
+			return value, newError(VALUE_ERROR, "%s is out of range for %s, got=%d", path, t, integer.Value)
+		}
+		value.SetInt(integer.Value)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		integer, ok := obj.(*Integer)
+		if !ok {
+			return value, mismatch(path, INTEGER_OBJ, obj)
+		}
+		if integer.Value < 0 || value.OverflowUint(uint64(integer.Value)) {
+			return value, newError(VALUE_ERROR, "%s is out of range for %s, got=%d", path, t, integer.Value)
+		}
+		value.SetUint(uint64(integer.Value))
+
+	case reflect.Float32, reflect.Float64:
+		integer, ok := obj.(*Integer)
+		if !ok {
+			return value, mismatch(path, INTEGER_OBJ, obj)
+		}
+		value.SetFloat(float64(integer.Value))
+
+	case reflect.Slice, reflect.Array:
+		iter, ok := NewIterator(obj)
+		if !ok {
+			return value, mismatch(path, ARRAY_OBJ, obj)
+		}
+
+		elements := []reflect.Value{}
+		for elem, ok := iter.Next(); ok; elem, ok = iter.Next() {
+			converted, err := toGo(elem, t.Elem(), fmt.Sprintf("%s[%d]", path, len(elements)))
+			if err != nil {
+				return value, err
+			}
+			elements = append(elements, converted)
+		}
+
+		if t.Kind() == reflect.Slice {
+			value.Set(reflect.MakeSlice(t, len(elements), len(elements)))
+		} else if len(elements) != t.Len() {
+			return value, newError(VALUE_ERROR, "%s must have %d elements, got=%d", path, t.Len(), len(elements))
+		}
+		for i, elem := range elements {
+			value.Index(i).Set(elem)
+		}
+
+	case reflect.Map:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return value, mismatch(path, HASH_OBJ, obj)
+		}
+
+		value.Set(reflect.MakeMapWithSize(t, hash.Len()))
+		for _, pair := range hash.Pairs() {
+			key, err := toGo(pair.Key, t.Key(), path+" key")
+			if err != nil {
+				return value, err
+			}
+			elem, err := toGo(pair.Value, t.Elem(), fmt.Sprintf("%s[%s]", path, pair.Key.Inspect()))
+			if err != nil {
+				return value, err
+			}
+			value.SetMapIndex(key, elem)
+		}
+
+	case reflect.Struct:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return value, mismatch(path, HASH_OBJ, obj)
+		}
+
+		for _, field := range structFields(t) {
+			fieldValue, ok := hash.Get(&String{Value: field.name})
+			if !ok {
+				continue
+			}
+			elem, err := toGo(fieldValue, t.FieldByIndex(field.index).Type, path+"."+field.name)
+			if err != nil {
+				return value, err
+			}
+			value.FieldByIndex(field.index).Set(elem)
+		}
+
+	case reflect.Ptr:
+		elem, err := toGo(obj, t.Elem(), path)
+		if err != nil {
+			return value, err
+		}
+		value.Set(reflect.New(t.Elem()))
+		value.Elem().Set(elem)
+
+	case reflect.Func:
+		return toGoFunc(obj, t, path)
+
+	default:
+		return value, newError(TYPE_ERROR, "%s has unsupported type %s", path, t)
+	}
+
+	return value, nil
+}
+
+// toNatural converts obj to the Go value it most naturally stands for.
+func toNatural(obj Object, path string) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *Null:
+		return nil, nil
+
+	case *Integer:
+		return obj.Value, nil
+
+	case *String:
+		return obj.Value, nil
+
+	case *Boolean:
+		return obj.Value, nil
+
+	case *Array:
+		elements := make([]interface{}, obj.Len())
+		for i, elem := range obj.Elements() {
+			natural, err := toNatural(elem, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = natural
+		}
+		return elements, nil
+
+	case *Set:
+		return toNatural(NewArray(obj.Elements()), path)
+
+	case *Hash:
+		stringKeys := true
+		for _, pair := range obj.Pairs() {
+			if _, ok := pair.Key.(*String); !ok {
+				stringKeys = false
+			}
+		}
+
+		if stringKeys {
+			hash := make(map[string]interface{}, obj.Len())
+			for _, pair := range obj.Pairs() {
+				key := pair.Key.(*String).Value
+				natural, err := toNatural(pair.Value, fmt.Sprintf("%s[%q]", path, key))
+				if err != nil {
+					return nil, err
+				}
+				hash[key] = natural
+			}
+			return hash, nil
+		}
+
+		hash := make(map[interface{}]interface{}, obj.Len())
+		for _, pair := range obj.Pairs() {
+			key, _ := toNatural(pair.Key, path+" key")
+			if !reflect.TypeOf(key).Comparable() {
+				return nil, newError(TYPE_ERROR, "%s key is unusable as Go map key: %s", path, pair.Key.Type())
+			}
+			natural, err := toNatural(pair.Value, fmt.Sprintf("%s[%s]", path, pair.Key.Inspect()))
+			if err != nil {
+				return nil, err
+			}
+			hash[key] = natural
+		}
+		return hash, nil
+
+	default:
+		return obj, nil
+	}
+}
+
+func toGoFunc(obj Object, t reflect.Type, path string) (reflect.Value, error) {
+	switch obj.(type) {
+	case *Builtin, *Function:
+	default:
+		return reflect.Value{}, mismatch(path, FUNCTION_OBJ, obj)
+	}
+	call := func(args ...Object) Object { return callFromGo(obj, args...) }
+
+	if err := checkFuncType(t, path); err != nil {
+		return reflect.Value{}, err
+	}
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+
+	fn := reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+		fail := func(err error) []reflect.Value {
+			if !returnsError {
+				// as an *Error, so FuncBuiltin can tell it from other panics
+				panic(errorObject(err))
+			}
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+
+		if t.IsVariadic() {
+			variadic := in[len(in)-1]
+			in = in[:len(in)-1]
+			for i := 0; i < variadic.Len(); i++ {
+				in = append(in, variadic.Index(i))
+			}
+		}
+
+		args := make([]Object, len(in))
+		for i, arg := range in {
+			converted, err := fromGo(arg, fmt.Sprintf("argument %d", i+1), map[uintptr]bool{})
+			if err != nil {
+				return fail(err)
+			}
+			args[i] = converted
+		}
+
+		result := call(args...)
+		if err, ok := result.(*Error); ok {
+			return fail(err)
+		}
+
+		if len(out) > 0 && !(returnsError && len(out) == 1) {
+			converted, err := toGo(result, t.Out(0), "result")
+			if err != nil {
+				return fail(err)
+			}
+			out[0] = converted
+		}
+		return out
+	})
+
+	return fn, nil
+}
+
+// checkFuncType checks the parameters and results of t can be converted,
+// allowing for a final error result.
+func checkFuncType(t reflect.Type, path string) error {
+	for i := 0; i < t.NumIn(); i++ {
+		if !supportedType(paramType(t, i), map[reflect.Type]bool{}) {
+			return fmt.Errorf("%s has unsupported parameter type %s", path, t.In(i))
+		}
+	}
+
+	results := t.NumOut()
+	if results > 0 && t.Out(results-1) == errorType {
+		results--
+	}
+	if results > 1 || (results == 1 && !supportedType(t.Out(0), map[reflect.Type]bool{})) {
+		return fmt.Errorf("%s has unsupported results %s", path, t)
+	}
+
+	return nil
+}
+
+// supportedType reports whether values of type t can be converted both ways.
+func supportedType(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if t.Implements(objectType) || seen[t] {
+		return true
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+
+	case reflect.Interface:
+		return t.NumMethod() == 0
+
+	case reflect.Slice, reflect.Array, reflect.Ptr:
+		return supportedType(t.Elem(), seen)
+
+	case reflect.Map:
+		return supportedType(t.Key(), seen) && supportedType(t.Elem(), seen)
+
+	case reflect.Struct:
+		for _, field := range structFields(t) {
+			if !supportedType(t.FieldByIndex(field.index).Type, seen) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Func:
+		return checkFuncType(t, "") == nil
+
+	default:
+		return false
+	}
+}
+
+type structField struct {
+	name  string
+	index []int
+}
+
+// structFields lists the exported fields of t under their Monkey names.
+func structFields(t reflect.Type) []structField {
+	fields := []structField{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("monkey"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+
+		fields = append(fields, structField{name: name, index: field.Index})
+	}
+
+	return fields
+}
+
+// lessMapKey orders Go map keys: numbers and strings by value, anything else
+// by how it prints.
+func lessMapKey(a, b reflect.Value) bool {
+	for a.Kind() == reflect.Interface && !a.IsNil() {
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Interface && !b.IsNil() {
+		b = b.Elem()
+	}
+
+	if a.Kind() == b.Kind() {
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.String:
+			return a.String() < b.String()
+		}
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+func nativeBool(value bool) *Boolean {
+	if value {
+		return TRUE
+	}
+	return FALSE
+}
+
+func isNil(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func:
+		return value.IsNil()
+	default:
+		return false
+	}
+}
@@ -0,0 +1,258 @@
+package object
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type point struct {
+	X      int
+	Y      int    `monkey:"y_coord"`
+	Label  string `monkey:"-"`
+	hidden bool
+}
+
+func TestFromGo(t *testing.T) {
+	var nilSlice []int
+	var nilPointer *point
+
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{3.0, "3"},
+		{"hi", "hi"},
+		{true, "true"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{nilSlice, "[]"},
+		{nilPointer, "null"},
+		{[]interface{}{1, "two", nil, []bool{false}}, "[1, two, null, [false]]"},
+		{map[string]int{"one": 1}, "{one: 1}"},
+		{map[string]int{"b": 2, "c": 3, "a": 1}, "{a: 1, b: 2, c: 3}"},
+		{map[int]bool{10: true, 2: false}, "{2: false, 10: true}"},
+		{point{X: 1, Y: 2}, "{X: 1, y_coord: 2}"},
+		{struct{ Name string }{"monkey"}, "{Name: monkey}"},
+		{&Integer{Value: 5}, "5"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%#v) failed: %s", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v) wrong. want=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+}
+
+func TestFromGoStruct(t *testing.T) {
+	for _, input := range []interface{}{point{X: 1, Y: 2, Label: "p"}, &point{X: 1, Y: 2}} {
+		hash, ok := mustFromGo(t, input).(*Hash)
+		if !ok {
+			t.Fatalf("FromGo(%#v) is not Hash", input)
+		}
+
+		expected := map[string]int64{"X": 1, "y_coord": 2}
+		if hash.Len() != len(expected) {
+			t.Errorf("wrong number of pairs. want=%d, got=%d", len(expected), hash.Len())
+		}
+		for key, value := range expected {
+			got, ok := hash.Get(&String{Value: key})
+			if !ok {
+				t.Errorf("no pair for %q in %s", key, hash.Inspect())
+				continue
+			}
+			if integer, ok := got.(*Integer); !ok || integer.Value != value {
+				t.Errorf("wrong value for %q. want=%d, got=%s", key, value, got.Inspect())
+			}
+		}
+	}
+}
+
+func TestFromGoFunction(t *testing.T) {
+	obj, err := FromGo(func(a, b int) int { return a + b })
+	if err != nil {
+		t.Fatalf("FromGo failed: %s", err)
+	}
+
+	builtin, ok := obj.(*Builtin)
+	if !ok {
+		t.Fatalf("obj is not Builtin. got=%T", obj)
+	}
+
+	result := builtin.Fn(&Integer{Value: 2}, &Integer{Value: 3})
+	if integer, ok := result.(*Integer); !ok || integer.Value != 5 {
+		t.Errorf("wrong result. want=5, got=%s", result.Inspect())
+	}
+}
+
+func TestFromGoErrors(t *testing.T) {
+	type cyclic struct{ Next *cyclic }
+	loop := &cyclic{}
+	loop.Next = loop
+
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{1.5, "value is not a whole number, got=1.5"},
+		{uint64(1 << 63), "value is out of range for INTEGER, got=9223372036854775808"},
+		{[]interface{}{1, make(chan int)}, "value[1] has unsupported type chan int"},
+		{map[string]complex64{"z": 1i}, "value[z] has unsupported type complex64"},
+		{struct{ C chan int }{}, "value.C has unsupported type chan int"},
+		{map[Object]int{NULL: 3}, "value key is unusable as hash key: NULL"},
+		{loop, "value.Next is cyclic"},
+	}
+
+	for _, tt := range tests {
+		_, err := FromGo(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestToGo(t *testing.T) {
+	array := NewArray([]Object{&Integer{Value: 1}, &Integer{Value: 2}})
+	hash := mustFromGo(t, map[string]interface{}{"X": 1, "y_coord": 2, "Label": "ignored"})
+	mixed := mustFromGo(t, map[interface{}]interface{}{1: "one", true: nil})
+
+	var i int
+	var u uint16
+	var f float64
+	var s string
+	var b bool
+	var ints []int
+	var pair [2]int64
+	var strs map[string]int
+	var p point
+	var pp *point
+	var any interface{}
+	var anyArray interface{}
+	var anyHash interface{}
+	var anyMixed interface{}
+	var obj Object
+	var integer *Integer
+
+	tests := []struct {
+		input    Object
+		target   interface{}
+		expected interface{}
+	}{
+		{&Integer{Value: -4}, &i, -4},
+		{&Integer{Value: 65535}, &u, uint16(65535)},
+		{&Integer{Value: 2}, &f, 2.0},
+		{&String{Value: "hi"}, &s, "hi"},
+		{TRUE, &b, true},
+		{array, &ints, []int{1, 2}},
+		{&Range{Start: 1, End: 3}, &ints, []int{1, 2}},
+		{NULL, &ints, []int(nil)},
+		{array, &pair, [2]int64{1, 2}},
+		{mustFromGo(t, map[string]int{"a": 1}), &strs, map[string]int{"a": 1}},
+		{hash, &p, point{X: 1, Y: 2}},
+		{hash, &pp, &point{X: 1, Y: 2}},
+		{NULL, &pp, (*point)(nil)},
+		{&Integer{Value: 7}, &any, int64(7)},
+		{NULL, &any, nil},
+		{array, &anyArray, []interface{}{int64(1), int64(2)}},
+		{mustFromGo(t, map[string]interface{}{"a": []int{1}}), &anyHash, map[string]interface{}{"a": []interface{}{int64(1)}}},
+		{mixed, &anyMixed, map[interface{}]interface{}{int64(1): "one", true: nil}},
+		{array, &obj, array},
+		{&Integer{Value: 9}, &integer, &Integer{Value: 9}},
+	}
+
+	for _, tt := range tests {
+		if err := ToGo(tt.input, tt.target); err != nil {
+			t.Errorf("ToGo(%s) failed: %s", tt.input.Inspect(), err)
+			continue
+		}
+		got := reflect.ValueOf(tt.target).Elem().Interface()
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ToGo(%s) wrong. want=%#v, got=%#v", tt.input.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestToGoErrors(t *testing.T) {
+	var i int8
+	var u uint
+	var ints []int
+	var pair [3]int
+	var p point
+	var integer *Integer
+	var ch chan int
+
+	tests := []struct {
+		input    Object
+		target   interface{}
+		expected string
+	}{
+		{&Integer{Value: 1}, i, "target must be a non-nil pointer, got int8"},
+		{&Integer{Value: 1}, (*int)(nil), "target must be a non-nil pointer, got *int"},
+		{&String{Value: "x"}, &i, "value must be INTEGER, got=STRING"},
+		{&Integer{Value: 300}, &i, "value is out of range for int8, got=300"},
+		{&Integer{Value: -1}, &u, "value is out of range for uint, got=-1"},
+		{mustFromGo(t, []interface{}{1, "two"}), &ints, "value[1] must be INTEGER, got=STRING"},
+		{mustFromGo(t, []int{1, 2}), &pair, "value must have 3 elements, got=2"},
+		{mustFromGo(t, map[string]interface{}{"X": true}), &p, "value.X must be INTEGER, got=BOOLEAN"},
+		{&String{Value: "x"}, &integer, "value must be INTEGER, got=STRING"},
+		{&Integer{Value: 1}, &ch, "value has unsupported type chan int"},
+	}
+
+	for _, tt := range tests {
+		err := ToGo(tt.input, tt.target)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestToGoFunction(t *testing.T) {
+	double := &Builtin{Fn: func(args ...Object) Object {
+		integer, ok := args[0].(*Integer)
+		if !ok {
+			return newError(TYPE_ERROR, "argument to `double` must be INTEGER, got=%s", args[0].Type())
+		}
+		return &Integer{Value: integer.Value * 2}
+	}}
+
+	var fn func(int) int
+	if err := ToGo(double, &fn); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	if got := fn(21); got != 42 {
+		t.Errorf("wrong result. want=42, got=%d", got)
+	}
+
+	var checked func(interface{}) (int, error)
+	if err := ToGo(double, &checked); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	_, err := checked("x")
+	var monkeyErr *Error
+	if !errors.As(err, &monkeyErr) || monkeyErr.Message != "argument to `double` must be INTEGER, got=STRING" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	var unsupported func(chan int)
+	err = ToGo(double, &unsupported)
+	if err == nil || err.Error() != "value has unsupported parameter type chan int" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func mustFromGo(t *testing.T, value interface{}) Object {
+	t.Helper()
+	obj, err := FromGo(value)
+	if err != nil {
+		t.Fatalf("FromGo(%#v) failed: %s", value, err)
+	}
+	return obj
+}
@@ -1,31 +1,145 @@
 package object
 
+// Environments store their bindings in slots. The resolver in package eval
+// works out which slot (and how many environments out) each identifier lives
+// in before a program runs, so lookups are a short pointer walk and an index
+// instead of a map lookup per scope. Names are only kept for bindings made by
+// name, such as globals and macros, so hosts can still find them.
+
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{}
 }
 
-func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
+// NewEnvironmentWithBuiltins returns an environment in which code sees the
+// given builtins instead of Builtins.
+func NewEnvironmentWithBuiltins(builtins []BuiltinDefinition) *Environment {
+	return &Environment{builtins: builtins}
+}
 
-	return env
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	return &Environment{outer: outer}
 }
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store    []Object
+	names    map[string]int
+	outer    *Environment
+	builtins []BuiltinDefinition
+	modules  map[string]*Module
+	caller   Caller
+}
+
+// Builtins returns the builtins visible in e, which are set on the outermost
+// environment.
+func (e *Environment) Builtins() []BuiltinDefinition {
+	for e.outer != nil {
+		e = e.outer
+	}
+	if e.builtins == nil {
+		return Builtins
+	}
+	return e.builtins
+}
+
+// SetBuiltins replaces the builtins visible in e and everything enclosed by it.
+func (e *Environment) SetBuiltins(builtins []BuiltinDefinition) {
+	for e.outer != nil {
+		e = e.outer
+	}
+	e.builtins = builtins
+}
+
+// Caller returns what Go code calls functions made in e with, such as those
+// converted by ToGo, or nil to call them through Apply with no limits. It's
+// set on the outermost environment.
+func (e *Environment) Caller() Caller {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e.caller
+}
+
+// SetCaller sets what Go code calls functions made in e and everything
+// enclosed by it with.
+func (e *Environment) SetCaller(call Caller) {
+	for e.outer != nil {
+		e = e.outer
+	}
+	e.caller = call
+}
+
+// Modules returns the modules imported so far by code running in e, by
+// absolute path. Like builtins, they're kept on the outermost environment.
+func (e *Environment) Modules() map[string]*Module {
+	for e.outer != nil {
+		e = e.outer
+	}
+	if e.modules == nil {
+		e.modules = make(map[string]*Module)
+	}
+	return e.modules
+}
+
+// SetModules makes e share modules with another environment, so modules
+// imported from either are only evaluated once.
+func (e *Environment) SetModules(modules map[string]*Module) {
+	for e.outer != nil {
+		e = e.outer
+	}
+	e.modules = modules
+}
+
+// GetAt returns the value in slot of the environment depth levels out.
+func (e *Environment) GetAt(depth, slot int) (Object, bool) {
+	for ; depth > 0 && e != nil; depth-- {
+		e = e.outer
+	}
+	if e == nil || slot >= len(e.store) || e.store[slot] == nil {
+		return nil, false
+	}
+	return e.store[slot], true
+}
+
+// SetAt stores value in slot, growing the environment as needed.
+func (e *Environment) SetAt(slot int, value Object) Object {
+	for slot >= len(e.store) {
+		e.store = append(e.store, nil)
+	}
+	e.store[slot] = value
+	return value
+}
+
+// Slot returns the slot bound to name in this environment, allocating an
+// empty one if there isn't one yet.
+func (e *Environment) Slot(name string) int {
+	if slot, ok := e.names[name]; ok {
+		return slot
+	}
+	if e.names == nil {
+		e.names = make(map[string]int)
+	}
+	slot := len(e.store)
+	e.names[name] = slot
+	e.store = append(e.store, nil)
+	return slot
+}
+
+// Lookup returns the slot bound to name in this environment only.
+func (e *Environment) Lookup(name string) (int, bool) {
+	slot, ok := e.names[name]
+	return slot, ok
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	if slot, ok := e.names[name]; ok && e.store[slot] != nil {
+		return e.store[slot], true
 	}
-	return obj, ok
+	if e.outer != nil {
+		return e.outer.Get(name)
+	}
+	return nil, false
 }
 
 func (e *Environment) Set(name string, value Object) Object {
-	e.store[name] = value
-	return value
+	return e.SetAt(e.Slot(name), value)
 }
@@ -0,0 +1,83 @@
+package object
+
+// Equal reports whether a and b are equal under ==. Arrays, hashes and sets
+// are compared element by element, and values of different types are never
+// equal. Functions, builtins and the like are only equal to themselves.
+func Equal(a, b Object) bool {
+	return equal(a, b, make(map[[2]Object]bool))
+}
+
+// equal is Equal, where seen holds the pairs of arrays and hashes already
+// being compared further up, so cyclic values don't recurse forever. A pair
+// met again is taken to be equal; if it isn't, some other part of the
+// comparison will say so.
+func equal(a, b Object, seen map[[2]Object]bool) bool {
+	if a == b {
+		return true
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value == b.(*Integer).Value
+	case *String:
+		return a.Value == b.(*String).Value
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+	case *Range:
+		b := b.(*Range)
+		return a.Start == b.Start && a.End == b.End
+
+	case *Array:
+		b := b.(*Array)
+		if a.Len() != b.Len() {
+			return false
+		}
+		pair := [2]Object{a, b}
+		if seen[pair] {
+			return true
+		}
+		seen[pair] = true
+		for i := 0; i < a.Len(); i++ {
+			if !equal(a.elements.at(i), b.elements.at(i), seen) {
+				return false
+			}
+		}
+		return true
+
+	case *Hash:
+		b := b.(*Hash)
+		if a.Len() != b.Len() {
+			return false
+		}
+		pair := [2]Object{a, b}
+		if seen[pair] {
+			return true
+		}
+		seen[pair] = true
+		for _, pair := range a.Pairs() {
+			value, ok := b.Get(pair.Key)
+			if !ok || !equal(pair.Value, value, seen) {
+				return false
+			}
+		}
+		return true
+
+	case *Set:
+		b := b.(*Set)
+		if a.Len() != b.Len() {
+			return false
+		}
+		for _, elem := range a.Elements() {
+			if !b.Contains(elem) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return false
+	}
+}
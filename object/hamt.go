@@ -0,0 +1,151 @@
+package object
+
+import "math/bits"
+
+// hamt is a persistent map from HashKeys to the positions of the pairs
+// bucketed under them, a hash array mapped trie: each level picks one of 32
+// slots by the next five bits of the key's hash, and only slots in use take
+// up room. Like vector, changing one makes a new one sharing most of the old.
+// The zero hamt is empty.
+type hamt struct {
+	root *hamtNode
+}
+
+type hamtNode struct {
+	bitmap uint32 // which of the 32 slots are in use
+	slots  []hamtSlot
+}
+
+// hamtSlot is either a subtrie, or the entries for keys whose hashes are the
+// same all the way down.
+type hamtSlot struct {
+	node    *hamtNode
+	hash    uint64
+	entries []hamtEntry
+}
+
+type hamtEntry struct {
+	key     HashKey
+	indexes []int
+}
+
+const hamtBits = 5
+
+func hamtHash(key HashKey) uint64 {
+	return mix(fnvOffset, key)
+}
+
+// get returns the positions bucketed under key.
+func (m hamt) get(key HashKey) []int {
+	hash := hamtHash(key)
+
+	node := m.root
+	for shift := uint(0); node != nil; shift += hamtBits {
+		bit := uint32(1) << ((hash >> shift) & 31)
+		if node.bitmap&bit == 0 {
+			return nil
+		}
+
+		slot := node.slots[bits.OnesCount32(node.bitmap&(bit-1))]
+		if slot.node != nil {
+			node = slot.node
+			continue
+		}
+		for _, entry := range slot.entries {
+			if entry.key == key {
+				return entry.indexes
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// set returns m with the positions bucketed under key replaced by indexes, or
+// with key removed if there are none.
+func (m hamt) set(key HashKey, indexes []int) hamt {
+	root := m.root
+	if root == nil {
+		root = &hamtNode{}
+	}
+
+	root = root.set(0, hamtHash(key), hamtEntry{key: key, indexes: indexes})
+	if root != nil && root.bitmap == 0 {
+		root = nil
+	}
+	return hamt{root: root}
+}
+
+// set returns n with entry set in the subtrie shift bits down, or nil if that
+// leaves n empty.
+func (n *hamtNode) set(shift uint, hash uint64, entry hamtEntry) *hamtNode {
+	bit := uint32(1) << ((hash >> shift) & 31)
+	pos := bits.OnesCount32(n.bitmap & (bit - 1))
+
+	if n.bitmap&bit == 0 {
+		if len(entry.indexes) == 0 {
+			return n
+		}
+		slots := make([]hamtSlot, len(n.slots)+1)
+		copy(slots, n.slots[:pos])
+		slots[pos] = hamtSlot{hash: hash, entries: []hamtEntry{entry}}
+		copy(slots[pos+1:], n.slots[pos:])
+		return &hamtNode{bitmap: n.bitmap | bit, slots: slots}
+	}
+
+	slot := n.slots[pos]
+	switch {
+	case slot.node != nil:
+		child := slot.node.set(shift+hamtBits, hash, entry)
+		if child == nil {
+			return n.without(bit, pos)
+		}
+		slot = hamtSlot{node: child}
+
+	case slot.hash == hash:
+		entries := []hamtEntry{}
+		for _, existing := range slot.entries {
+			if existing.key != entry.key {
+				entries = append(entries, existing)
+			}
+		}
+		if len(entry.indexes) > 0 {
+			entries = append(entries, entry)
+		}
+		if len(entries) == 0 {
+			return n.without(bit, pos)
+		}
+		slot = hamtSlot{hash: hash, entries: entries}
+
+	default:
+		if len(entry.indexes) == 0 {
+			return n
+		}
+		// two hashes share this slot, so split it into a subtrie holding both
+		child := newHamtNode(shift+hamtBits, slot)
+		slot = hamtSlot{node: child.set(shift+hamtBits, hash, entry)}
+	}
+
+	slots := append([]hamtSlot{}, n.slots...)
+	slots[pos] = slot
+	return &hamtNode{bitmap: n.bitmap, slots: slots}
+}
+
+// newHamtNode makes a node holding just slot, at the level shift bits down.
+func newHamtNode(shift uint, slot hamtSlot) *hamtNode {
+	bit := uint32(1) << ((slot.hash >> shift) & 31)
+	return &hamtNode{bitmap: bit, slots: []hamtSlot{slot}}
+}
+
+// without returns n with the slot for bit, at pos, removed, or nil if that
+// leaves n empty.
+func (n *hamtNode) without(bit uint32, pos int) *hamtNode {
+	if n.bitmap == bit {
+		return nil
+	}
+
+	slots := make([]hamtSlot, 0, len(n.slots)-1)
+	slots = append(slots, n.slots[:pos]...)
+	slots = append(slots, n.slots[pos+1:]...)
+	return &hamtNode{bitmap: n.bitmap &^ bit, slots: slots}
+}
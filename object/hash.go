@@ -0,0 +1,269 @@
+package object
+
+// Hash maps keys to values, keeping its pairs in the order their keys were
+// first set. Pairs are bucketed by their keys' HashKeys and told apart within
+// a bucket by Equal, so keys whose HashKeys collide are still kept apart. The
+// zero Hash is empty and ready to use.
+//
+// The pairs and buckets are persistent, so With and Without make new hashes
+// sharing most of the old in O(log n); Set and Delete change the hash itself.
+// Arrays, hashes and sets are copied when they're used as keys, so changing
+// one afterwards (with set! and friends) doesn't change the key.
+type Hash struct {
+	pairs   vector[HashPair] // deleted pairs are left with a nil Key
+	buckets hamt             // positions in pairs by HashKey
+	deleted int
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+func NewHash() *Hash {
+	return &Hash{}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string  { return inspect(h, make(map[Object]bool)) }
+
+// Len is the number of pairs in h.
+func (h *Hash) Len() int { return h.pairs.len() - h.deleted }
+
+// Get returns the value for key, if h has one.
+func (h *Hash) Get(key Object) (Object, bool) {
+	i, _, _ := h.find(key)
+	if i < 0 {
+		return nil, false
+	}
+	return h.pairs.at(i).Value, true
+}
+
+// Set maps key to value, replacing any value key had without moving it. It
+// reports false, and leaves h alone, if key can't be used as a hash key.
+func (h *Hash) Set(key Object, value Object) bool {
+	i, hashed, ok := h.find(key)
+	if !ok {
+		return false
+	}
+	if i >= 0 {
+		h.pairs = h.pairs.set(i, HashPair{Key: h.pairs.at(i).Key, Value: value})
+		return true
+	}
+
+	bucket := h.buckets.get(hashed)
+	h.buckets = h.buckets.set(hashed, append(bucket[:len(bucket):len(bucket)], h.pairs.len()))
+	h.pairs = h.pairs.push(HashPair{Key: copyKey(key), Value: value})
+	return true
+}
+
+// With returns a new hash of h's pairs with key mapped to value, or false if
+// key can't be used as a hash key. h is left as it was.
+func (h *Hash) With(key Object, value Object) (*Hash, bool) {
+	with := *h
+	return &with, with.Set(key, value)
+}
+
+// Delete removes key and its value from h, reporting whether it was there.
+func (h *Hash) Delete(key Object) bool {
+	i, hashed, _ := h.find(key)
+	if i < 0 {
+		return false
+	}
+
+	bucket := []int{}
+	for _, index := range h.buckets.get(hashed) {
+		if index != i {
+			bucket = append(bucket, index)
+		}
+	}
+	h.buckets = h.buckets.set(hashed, bucket)
+
+	h.pairs = h.pairs.set(i, HashPair{})
+	h.deleted++
+	if h.deleted > h.pairs.len()/2 {
+		h.compact()
+	}
+	return true
+}
+
+// Without returns a new hash of h's pairs without key. h is left as it was.
+func (h *Hash) Without(key Object) *Hash {
+	without := *h
+	without.Delete(key)
+	return &without
+}
+
+// find returns the position in h.pairs of key's pair, or -1 if there isn't
+// one, along with key's HashKey, or false if key can't be a hash key.
+func (h *Hash) find(key Object) (int, HashKey, bool) {
+	hashed, ok := HashKeyOf(key)
+	if !ok {
+		return -1, hashed, false
+	}
+
+	for _, i := range h.buckets.get(hashed) {
+		if Equal(h.pairs.at(i).Key, key) {
+			return i, hashed, true
+		}
+	}
+	return -1, hashed, true
+}
+
+// compact drops deleted pairs, so deleting a lot doesn't leave h slow to
+// walk through.
+func (h *Hash) compact() {
+	pairs := h.Pairs()
+	h.pairs = newVector(pairs)
+	h.buckets = hamt{}
+	h.deleted = 0
+
+	for i, pair := range pairs {
+		hashed, _ := HashKeyOf(pair.Key)
+		bucket := h.buckets.get(hashed)
+		h.buckets = h.buckets.set(hashed, append(bucket[:len(bucket):len(bucket)], i))
+	}
+}
+
+// Pairs returns h's pairs in order.
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, h.Len())
+	h.pairs.each(func(_ int, pair HashPair) {
+		if pair.Key != nil {
+			pairs = append(pairs, pair)
+		}
+	})
+	return pairs
+}
+
+// Keys returns h's keys in order.
+func (h *Hash) Keys() []Object {
+	keys := make([]Object, 0, h.Len())
+	for _, pair := range h.Pairs() {
+		keys = append(keys, pair.Key)
+	}
+	return keys
+}
+
+// Values returns h's values in the order of their keys.
+func (h *Hash) Values() []Object {
+	values := make([]Object, 0, h.Len())
+	for _, pair := range h.Pairs() {
+		values = append(values, pair.Value)
+	}
+	return values
+}
+
+// copyKey copies key if it's an array, hash or set, which can be changed.
+// The copy is deep, since their elements can be too.
+func copyKey(key Object) Object {
+	switch key := key.(type) {
+	case *Array:
+		elements := key.Elements()
+		for i, elem := range elements {
+			elements[i] = copyKey(elem)
+		}
+		return NewArray(elements)
+
+	case *Hash:
+		hash := NewHash()
+		for _, pair := range key.Pairs() {
+			hash.Set(pair.Key, copyKey(pair.Value))
+		}
+		return hash
+
+	case *Set:
+		// elements are already copied, being keys themselves
+		set := NewSet()
+		for _, elem := range key.Elements() {
+			set.Add(elem)
+		}
+		return set
+
+	default:
+		return key
+	}
+}
+
+// HashKeyOf returns the HashKey key is bucketed under in a Hash, or false if
+// key can't be used as a hash key. Integers, strings and booleans can, and so
+// can arrays, hashes and sets made only of things that can.
+func HashKeyOf(key Object) (HashKey, bool) {
+	return hashKeyOf(key, make(map[Object]bool))
+}
+
+// hashKeyOf is HashKeyOf, where seen holds the arrays and hashes already being
+// hashed further up; a cyclic value can't be a key.
+func hashKeyOf(key Object, seen map[Object]bool) (HashKey, bool) {
+	switch key := key.(type) {
+	case Hashable:
+		return key.HashKey(), true
+
+	case *Array:
+		if seen[key] {
+			return HashKey{}, false
+		}
+		seen[key] = true
+		defer delete(seen, key)
+
+		value := uint64(fnvOffset)
+		for _, elem := range key.Elements() {
+			hashed, ok := hashKeyOf(elem, seen)
+			if !ok {
+				return HashKey{}, false
+			}
+			value = mix(value, hashed)
+		}
+		return HashKey{Type: key.Type(), Value: value}, true
+
+	case *Hash:
+		if seen[key] {
+			return HashKey{}, false
+		}
+		seen[key] = true
+		defer delete(seen, key)
+
+		// summed so the order pairs come in doesn't matter
+		var value uint64
+		for _, pair := range key.Pairs() {
+			hashedKey, ok := hashKeyOf(pair.Key, seen)
+			if !ok {
+				return HashKey{}, false
+			}
+			hashedValue, ok := hashKeyOf(pair.Value, seen)
+			if !ok {
+				return HashKey{}, false
+			}
+			value += mix(mix(fnvOffset, hashedKey), hashedValue)
+		}
+		return HashKey{Type: key.Type(), Value: value}, true
+
+	case *Set:
+		// elements can't be cyclic, they're all usable as keys already
+		var value uint64
+		for _, elem := range key.Elements() {
+			hashed, _ := hashKeyOf(elem, seen)
+			value += mix(fnvOffset, hashed)
+		}
+		return HashKey{Type: key.Type(), Value: value}, true
+
+	default:
+		return HashKey{}, false
+	}
+}
+
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+// mix folds key into the FNV-style running hash h.
+func mix(h uint64, key HashKey) uint64 {
+	for _, b := range []byte(key.Type) {
+		h = (h ^ uint64(b)) * fnvPrime
+	}
+	for i := 0; i < 8; i++ {
+		h = (h ^ (key.Value >> (8 * i) & 0xff)) * fnvPrime
+	}
+	return h
+}
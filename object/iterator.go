@@ -0,0 +1,51 @@
+package object
+
+// Iterator hands out the elements of an iterable value one at a time. Arrays,
+// ranges and sets yield their elements and hashes their keys, all in order.
+type Iterator struct {
+	next func() (Object, bool)
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
+
+// Next returns the next element, or false once the iterator is exhausted.
+func (it *Iterator) Next() (Object, bool) {
+	return it.next()
+}
+
+// NewIterator returns an iterator over obj, or false if obj isn't iterable.
+func NewIterator(obj Object) (*Iterator, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		elements := obj.elements
+		i := 0
+		return &Iterator{next: func() (Object, bool) {
+			if i >= elements.len() {
+				return nil, false
+			}
+			i++
+			return elements.at(i - 1), true
+		}}, true
+
+	case *Range:
+		current := obj.Start
+		end := obj.End
+		return &Iterator{next: func() (Object, bool) {
+			if current >= end {
+				return nil, false
+			}
+			current++
+			return &Integer{Value: current - 1}, true
+		}}, true
+
+	case *Hash:
+		return NewIterator(NewArray(obj.Keys()))
+
+	case *Set:
+		return NewIterator(NewArray(obj.Elements()))
+
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,115 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// MarshalJSON writes h as a JSON object with its pairs in order. Keys that
+// aren't strings are written as they print, unless another key prints the
+// same, like 1 and "1", which is an error rather than a duplicate key.
+func (h *Hash) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	if err := writeJSON(&out, h, make(map[Object]bool)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// MarshalJSON writes a as a JSON array.
+func (a *Array) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	if err := writeJSON(&out, a, make(map[Object]bool)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// writeJSON writes obj to out as JSON. seen holds the arrays and hashes being
+// written further up, since JSON has no way to write one holding itself.
+func writeJSON(out *bytes.Buffer, obj Object, seen map[Object]bool) error {
+	switch obj := obj.(type) {
+	case *Null:
+		out.WriteString("null")
+		return nil
+	case *Integer:
+		return writeJSONValue(out, obj.Value)
+	case *String:
+		return writeJSONValue(out, obj.Value)
+	case *Boolean:
+		return writeJSONValue(out, obj.Value)
+
+	case *Array:
+		if seen[obj] {
+			return newError(VALUE_ERROR, "cyclic ARRAY can't be written as JSON")
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		return writeJSONArray(out, obj.Elements(), seen)
+
+	case *Set:
+		return writeJSONArray(out, obj.Elements(), seen)
+
+	case *Hash:
+		if seen[obj] {
+			return newError(VALUE_ERROR, "cyclic HASH can't be written as JSON")
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		out.WriteString("{")
+		written := make(map[string]Object, obj.Len())
+		for i, pair := range obj.Pairs() {
+			if i > 0 {
+				out.WriteString(",")
+			}
+
+			key := pair.Key.Inspect()
+			if str, ok := pair.Key.(*String); ok {
+				key = str.Value
+			}
+			if other, ok := written[key]; ok {
+				return newError(VALUE_ERROR, "hash keys of type %s and %s both write as JSON key %q",
+					other.Type(), pair.Key.Type(), key)
+			}
+			written[key] = pair.Key
+
+			if err := writeJSONValue(out, key); err != nil {
+				return err
+			}
+			out.WriteString(":")
+			if err := writeJSON(out, pair.Value, seen); err != nil {
+				return err
+			}
+		}
+		out.WriteString("}")
+		return nil
+
+	default:
+		return newError(TYPE_ERROR, "value of type %s can't be written as JSON", obj.Type())
+	}
+}
+
+func writeJSONArray(out *bytes.Buffer, elements []Object, seen map[Object]bool) error {
+	out.WriteString("[")
+	for i, elem := range elements {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		if err := writeJSON(out, elem, seen); err != nil {
+			return err
+		}
+	}
+	out.WriteString("]")
+	return nil
+}
+
+func writeJSONValue(out *bytes.Buffer, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	out.Write(encoded)
+	return nil
+}
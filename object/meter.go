@@ -0,0 +1,95 @@
+package object
+
+// Meter adds up the memory held by values, using the same estimates as
+// SizeOf, but counting whatever values share only once: an array and the
+// rest of it, or a hash and a copy of it with one more key, only add what
+// they don't have in common. Values left in a trie by rest and the like are
+// counted too, since they're still held.
+type Meter struct {
+	seen  map[interface{}]bool
+	bytes int64
+}
+
+func NewMeter() *Meter {
+	return &Meter{seen: make(map[interface{}]bool)}
+}
+
+// Bytes is the memory held by everything added so far.
+func (m *Meter) Bytes() int64 { return m.bytes }
+
+// Object adds obj and everything it holds.
+func (m *Meter) Object(obj Object) {
+	if obj == nil || !m.first(obj) {
+		return
+	}
+
+	switch obj := obj.(type) {
+	case *String:
+		m.bytes += SizeOf(obj)
+	case *Array:
+		m.bytes += arraySize(0)
+		meterVector(m, obj.elements, 16, m.Object)
+	case *Hash:
+		m.hash(obj)
+	case *Set:
+		m.hash(&obj.elements)
+	case *Function:
+		m.Environment(obj.Env)
+	case *ReturnValue:
+		m.Object(obj.Value)
+	case *Module:
+		for _, export := range obj.Exports {
+			m.Object(export)
+		}
+	}
+}
+
+// Environment adds the values bound in env and the environments it's in,
+// and the modules imported there.
+func (m *Meter) Environment(env *Environment) {
+	for ; env != nil && m.first(env); env = env.outer {
+		for _, value := range env.store {
+			m.Object(value)
+		}
+		for _, module := range env.modules {
+			m.Object(module)
+		}
+	}
+}
+
+func (m *Meter) hash(h *Hash) {
+	m.bytes += 48
+	meterVector(m, h.pairs, 64, func(pair HashPair) {
+		m.Object(pair.Key)
+		m.Object(pair.Value)
+	})
+}
+
+// first reports whether p is new to m, which it isn't afterwards.
+func (m *Meter) first(p interface{}) bool {
+	if m.seen[p] {
+		return false
+	}
+	m.seen[p] = true
+	return true
+}
+
+// meterVector adds the nodes of v's trie that m hasn't seen, counting size
+// for each item in them, and calls each with the items.
+func meterVector[T any](m *Meter, v vector[T], size int64, each func(T)) {
+	meterNode(m, v.root, size, each)
+}
+
+func meterNode[T any](m *Meter, n *vectorNode[T], size int64, each func(T)) {
+	if n == nil || !m.first(n) {
+		return
+	}
+
+	m.bytes += 8*int64(len(n.children)) + size*int64(len(n.items))
+	for _, child := range n.children {
+		meterNode(m, child, size, each)
+	}
+	for _, item := range n.items {
+		each(item)
+	}
+}
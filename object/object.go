@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
 	"monkey/ast"
+	"monkey/code"
 	"strings"
 )
 
@@ -14,15 +16,30 @@ const (
 	BOOLEAN_OBJ      = "BOOLEAN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	SET_OBJ          = "SET"
+	RANGE_OBJ        = "RANGE"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
 	FUNCTION_OBJ     = "FUNCTION"
 	ERROR_OBJ        = "ERROR"
+	ERROR_VALUE_OBJ  = "ERROR_VALUE"
 	BUILTIN_OBJ      = "BUILTIN"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
+	ITERATOR_OBJ     = "ITERATOR"
+	MODULE_OBJ       = "MODULE"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type ObjectType string
 
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
 type Object interface {
 	Type() ObjectType
 	Inspect() string
@@ -77,49 +94,163 @@ func (b *Boolean) HashKey() HashKey {
 	return HashKey{Type: b.Type(), Value: value}
 }
 
+// Array is a persistent vector of values: Push, Rest and With make new arrays
+// sharing most of the old in O(log n) or better, leaving it as it was, while
+// Append, Set and Pop change the array itself. The zero Array is empty.
+//
+// Arrays used to hold their elements in an exported Elements slice. Build
+// them with NewArray instead, and read them with Len, At or Elements.
 type Array struct {
-	Elements []Object
+	elements vector[Object]
+}
+
+// NewArray returns an array of elements. It copies them, so changing
+// elements afterwards doesn't change the array.
+func NewArray(elements []Object) *Array {
+	return &Array{elements: newVector(elements)}
 }
 
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
-func (a *Array) Inspect() string {
-	var out bytes.Buffer
+func (a *Array) Inspect() string  { return inspect(a, make(map[Object]bool)) }
+
+// Len is the number of elements in a.
+func (a *Array) Len() int { return a.elements.len() }
+
+// At returns the element at index, or false if index is out of range.
+func (a *Array) At(index int) (Object, bool) {
+	if index < 0 || index >= a.elements.len() {
+		return nil, false
+	}
+	return a.elements.at(index), true
+}
+
+// Elements returns a's elements in a new slice, which can be changed without
+// changing a.
+func (a *Array) Elements() []Object {
+	return a.elements.slice()
+}
+
+// Push returns a new array of a's elements followed by elem.
+func (a *Array) Push(elem Object) *Array {
+	return &Array{elements: a.elements.push(elem)}
+}
+
+// Rest returns a new array of all but a's first element.
+func (a *Array) Rest() *Array {
+	return &Array{elements: a.elements.rest()}
+}
+
+// With returns a new array of a's elements with the one at index, which must
+// be in range, replaced by elem.
+func (a *Array) With(index int, elem Object) *Array {
+	return &Array{elements: a.elements.set(index, elem)}
+}
+
+// Append adds elem to the end of a.
+func (a *Array) Append(elem Object) {
+	a.elements = a.elements.push(elem)
+}
+
+// Set replaces the element at index, which must be in range, with elem.
+func (a *Array) Set(index int, elem Object) {
+	a.elements = a.elements.set(index, elem)
+}
 
-	elems := []string{}
-	for _, elem := range a.Elements {
-		elems = append(elems, elem.Inspect())
+// Pop removes a's last element and returns it, or false if a is empty.
+func (a *Array) Pop() (Object, bool) {
+	last, ok := a.At(a.Len() - 1)
+	if ok {
+		a.elements = a.elements.pop()
 	}
+	return last, ok
+}
 
-	out.WriteString("[")
+// inspect is Inspect for arrays, hashes and sets, which can hold themselves
+// once changed in place. seen holds those being inspected further up, which
+// are shown as [...] or {...} rather than forever.
+func inspect(obj Object, seen map[Object]bool) string {
+	var open, close string
+	var elems []string
+
+	switch obj := obj.(type) {
+	case *Array:
+		open, close = "[", "]"
+		if seen[obj] {
+			return "[...]"
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		obj.elements.each(func(_ int, elem Object) {
+			elems = append(elems, inspect(elem, seen))
+		})
+
+	case *Hash:
+		open, close = "{", "}"
+		if seen[obj] {
+			return "{...}"
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		for _, pair := range obj.Pairs() {
+			elems = append(elems, inspect(pair.Key, seen)+": "+inspect(pair.Value, seen))
+		}
+
+	case *Set:
+		// elements are hash keys, which can't hold themselves
+		open, close = "#{", "}"
+		for _, elem := range obj.Elements() {
+			elems = append(elems, elem.Inspect())
+		}
+
+	default:
+		return obj.Inspect()
+	}
+
+	var out bytes.Buffer
+
+	out.WriteString(open)
 	out.WriteString(strings.Join(elems, ", "))
-	out.WriteString("]")
+	out.WriteString(close)
 
 	return out.String()
 }
 
-type Hash struct {
-	Pairs map[HashKey]HashPair
+// Range is a lazy, half-open sequence of integers [Start, End). Inclusive
+// ranges are normalised on construction so End is always exclusive, and only
+// remember they were written with ..= to print the same way.
+type Range struct {
+	Start     int64
+	End       int64
+	Inclusive bool
 }
 
-func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
 
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+func (r *Range) Inspect() string {
+	if r.Inclusive {
+		return fmt.Sprintf("%d..=%d", r.Start, r.End-1)
 	}
+	return fmt.Sprintf("%d..%d", r.Start, r.End)
+}
 
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
+func (r *Range) Len() int64 {
+	if r.End <= r.Start {
+		return 0
+	}
+	return r.End - r.Start
+}
 
-	return out.String()
+func (r *Range) At(index int64) (int64, bool) {
+	if index < 0 || index >= r.Len() {
+		return 0, false
+	}
+	return r.Start + index, true
 }
 
-type HashPair struct {
-	Key   Object
-	Value Object
+func (r *Range) Contains(value int64) bool {
+	return r.Start <= value && value < r.End
 }
 
 type Null struct{}
@@ -158,18 +289,285 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is the vm's function value. It reports FUNCTION_OBJ so scripts see
+// the same type whichever backend runs them.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
 type BuiltinFunction func(args ...Object) Object
 
+// Caller calls fn, a function or builtin, with args. Engines give one to the
+// builtins that call functions they're given, like map, so those functions
+// run on the engine that called the builtin and under its limits.
+type Caller func(fn Object, args ...Object) Object
+
 type Builtin struct {
 	Fn BuiltinFunction
+
+	// CallingFn is set on builtins that call functions. Engines use it in
+	// place of Fn, handing it their own Caller; Fn hands it one that calls
+	// functions through Apply, for Go code.
+	CallingFn func(call Caller, args ...Object) Object
+
+	// Size estimates the bytes a call with args allocates. Engines that limit
+	// memory check it before the call, refusing calls that would go over,
+	// and charge it afterwards. It's set on builtins that can return far more
+	// than they're given, like array of a range, or far less than SizeOf
+	// what they return, like first; the rest are charged SizeOf their result.
+	Size func(args ...Object) int64
+}
+
+// NewCallingBuiltin makes a builtin of fn, which calls functions through the
+// Caller it's given.
+func NewCallingBuiltin(fn func(call Caller, args ...Object) Object) *Builtin {
+	return &Builtin{
+		Fn:        func(args ...Object) Object { return fn(callFromGo, args...) },
+		CallingFn: fn,
+	}
+}
+
+// Call calls b with args, handing it call if it calls functions itself.
+func (b *Builtin) Call(call Caller, args ...Object) Object {
+	if b.CallingFn != nil {
+		return b.CallingFn(call, args...)
+	}
+	return b.Fn(args...)
+}
+
+// SizeOf estimates the memory held by a string, array or hash, not counting
+// the elements, which are charged when they're made. Everything else is
+// small and fixed in size, so isn't charged. Arrays and hashes made from
+// others share most of their memory, which this doesn't know about, so it
+// errs high; a Meter counts what's shared once.
+func SizeOf(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *String:
+		return 16 + int64(len(obj.Value))
+	case *Array:
+		return arraySize(int64(obj.Len()))
+	case *Hash:
+		return 48 + 64*int64(obj.Len())
+	case *Set:
+		return 48 + 64*int64(obj.Len())
+	default:
+		return 0
+	}
+}
+
+// arraySize is SizeOf an array of length elements, which is as much as an
+// int64 holds for lengths too big for it.
+func arraySize(length int64) int64 {
+	if length < 0 || length > (math.MaxInt64-24)/16 {
+		return math.MaxInt64
+	}
+	return 24 + 16*length
+}
+
+// Compose makes `f >> g`, a builtin that calls f with its arguments and g
+// with f's result. It calls them through the Caller it's given, so it runs on
+// whichever engine calls it rather than the one that made it.
+func Compose(f, g Object) *Builtin {
+	return NewCallingBuiltin(func(call Caller, args ...Object) Object {
+		result := call(f, args...)
+		if _, ok := result.(*Error); ok {
+			return result
+		}
+		return call(g, result)
+	})
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 
+// Error kinds, so scripts can tell one sort of failure from another.
+const (
+	TYPE_ERROR      = "TypeError"      // a value of the wrong type
+	VALUE_ERROR     = "ValueError"     // the right type, but a bad value
+	ARITY_ERROR     = "ArityError"     // the wrong number of arguments
+	NAME_ERROR      = "NameError"      // a name that isn't bound
+	SYNTAX_ERROR    = "SyntaxError"    // code that parses but can't run
+	IMPORT_ERROR    = "ImportError"    // a module that can't be loaded
+	RECURSION_ERROR = "RecursionError" // calls nested too deep
+
+	// DefaultErrorKind is the kind of errors that weren't given one, such
+	// as those thrown from strings.
+	DefaultErrorKind = "Error"
+)
+
 type Error struct {
+	Kind    string // one of the kinds above, a script's own, or empty for DefaultErrorKind
 	Message string
+	Trace   []Frame // innermost call first
+	Cause   *Error  // the error this one wraps, if any
+
+	// Fatal is set when the host stopped evaluation, e.g. because it was
+	// cancelled or ran over budget, rather than the program failing.
+	Fatal error
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	var out bytes.Buffer
+
+	out.WriteString("ERROR: " + e.Message)
+	for _, frame := range e.Trace {
+		out.WriteString("\n\tat " + frame.String())
+	}
+
+	return out.String()
+}
+
+// Error and Unwrap let hosts treat Monkey errors as Go errors.
+func (e *Error) Error() string { return e.Message }
+func (e *Error) Unwrap() error {
+	if e.Fatal != nil {
+		return e.Fatal
+	}
+	if e.Cause != nil {
+		return e.Cause
+	}
+	return nil
+}
+
+// HasKind reports whether e is of kind, or wraps an error that is.
+func (e *Error) HasKind(kind string) bool {
+	for ; e != nil; e = e.Cause {
+		if e.Kind == kind || (e.Kind == "" && kind == DefaultErrorKind) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorValue is an error caught by a try. Unlike an Error, which unwinds the
+// program until something catches it, it's an ordinary value that can be
+// passed around, looked into like a hash, and thrown again.
+type ErrorValue struct {
+	Error *Error
+}
+
+func (ev *ErrorValue) Type() ObjectType { return ERROR_VALUE_OBJ }
+func (ev *ErrorValue) Inspect() string  { return ev.Kind() + ": " + ev.Error.Message }
+
+func (ev *ErrorValue) Kind() string {
+	if ev.Error.Kind == "" {
+		return DefaultErrorKind
+	}
+	return ev.Error.Kind
+}
+
+// errorFields are the names of an ErrorValue's fields, in the order keys
+// lists them.
+var errorFields = []string{"kind", "message", "trace", "cause"}
+
+// Keys returns the names of ev's fields.
+func (ev *ErrorValue) Keys() []Object {
+	keys := make([]Object, len(errorFields))
+	for i, name := range errorFields {
+		keys[i] = &String{Value: name}
+	}
+	return keys
+}
+
+// Values returns ev's fields, in the same order as Keys.
+func (ev *ErrorValue) Values() []Object {
+	values := make([]Object, len(errorFields))
+	for i, name := range errorFields {
+		values[i], _ = ev.Field(name)
+	}
+	return values
+}
+
+// Field returns the error's "message", "kind", "trace" or "cause".
+func (ev *ErrorValue) Field(name string) (Object, bool) {
+	switch name {
+	case "cause":
+		if ev.Error.Cause == nil {
+			return NULL, true
+		}
+		return &ErrorValue{Error: ev.Error.Cause}, true
+	case "message":
+		return &String{Value: ev.Error.Message}, true
+	case "kind":
+		return &String{Value: ev.Kind()}, true
+	case "trace":
+		return traceArray(ev.Error), true
+	default:
+		return nil, false
+	}
+}
+
+// Frame is a function call an error passed through on its way out.
+type Frame struct {
+	Function string
+	Args     []string // short summaries of the arguments
+	Line     int      // where the call was made
+	Column   int
+}
+
+func (f Frame) String() string {
+	call := fmt.Sprintf("%s(%s)", f.Function, strings.Join(f.Args, ", "))
+	if f.Line == 0 {
+		return call
+	}
+	return fmt.Sprintf("%s (line %d, column %d)", call, f.Line, f.Column)
+}
+
+// Module is what importing a file evaluates to: the values of the file's
+// exported lets, by name.
+type Module struct {
+	Name    string // the path it was imported by
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return fmt.Sprintf("module(%q)", m.Name) }
+
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, param := range m.Parameters {
+		params = append(params, param.String())
+	}
+
+	out.WriteString("macro(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
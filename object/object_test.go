@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	h1 := &String{Value: "Hello World"}
@@ -21,3 +25,371 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with distinct content have same hashes")
 	}
 }
+
+func TestEqual(t *testing.T) {
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+
+	// a = [1, a] and b = [1, b] are the same infinite value; c = [2, c] isn't
+	a := NewArray([]Object{one})
+	a.Append(a)
+	b := NewArray([]Object{one})
+	b.Append(b)
+	c := NewArray([]Object{two})
+	c.Append(c)
+
+	h := NewHash()
+	h.Set(one, h)
+	g := NewHash()
+	g.Set(one, g)
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{a, b, true},
+		{a, c, false},
+		{a, a, true},
+		{h, g, true},
+		{h, a, false},
+		{NewArray([]Object{a}), NewArray([]Object{b}), true},
+		{NULL, NULL, true},
+		{NULL, FALSE, false},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d] wrong. want=%t, got=%t", i, tt.expected, got)
+		}
+	}
+}
+
+// collider is a key whose HashKey is the same as every other collider's.
+type collider struct{ name string }
+
+func (c *collider) Type() ObjectType { return "COLLIDER" }
+func (c *collider) Inspect() string  { return c.name }
+func (c *collider) HashKey() HashKey { return HashKey{Type: c.Type(), Value: 1} }
+
+func TestHashCollisions(t *testing.T) {
+	a := &collider{name: "a"}
+	b := &collider{name: "b"}
+
+	hash := NewHash()
+	hash.Set(a, &Integer{Value: 1})
+	hash.Set(b, &Integer{Value: 2})
+	hash.Set(a, &Integer{Value: 3})
+
+	if hash.Len() != 2 {
+		t.Fatalf("wrong number of pairs. want=2, got=%d", hash.Len())
+	}
+	for key, expected := range map[Object]int64{a: 3, b: 2} {
+		value, ok := hash.Get(key)
+		if !ok {
+			t.Errorf("no pair for %s", key.Inspect())
+			continue
+		}
+		if integer, ok := value.(*Integer); !ok || integer.Value != expected {
+			t.Errorf("wrong value for %s. want=%d, got=%s", key.Inspect(), expected, value.Inspect())
+		}
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	hash := NewHash()
+	for i, key := range []string{"c", "a", "b", "a"} {
+		hash.Set(&String{Value: key}, &Integer{Value: int64(i)})
+	}
+	nested := NewHash()
+	nested.Set(&Integer{Value: 2}, NewArray([]Object{NULL, TRUE}))
+	nested.Set(&Integer{Value: 1}, &String{Value: "one"})
+	hash.Set(&String{Value: "nested"}, nested)
+
+	expected := "{c: 0, a: 3, b: 2, nested: {2: [null, true], 1: one}}"
+	if hash.Inspect() != expected {
+		t.Errorf("wrong Inspect. want=%q, got=%q", expected, hash.Inspect())
+	}
+
+	keys := []string{}
+	iter, _ := NewIterator(hash)
+	for key, ok := iter.Next(); ok; key, ok = iter.Next() {
+		keys = append(keys, key.Inspect())
+	}
+	if strings.Join(keys, " ") != "c a b nested" {
+		t.Errorf("wrong iteration order. got=%v", keys)
+	}
+
+	out, err := json.Marshal(hash)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %s", err)
+	}
+	expected = `{"c":0,"a":3,"b":2,"nested":{"2":[null,true],"1":"one"}}`
+	if string(out) != expected {
+		t.Errorf("wrong JSON. want=%s, got=%s", expected, out)
+	}
+
+	nested.Set(&String{Value: "1"}, NULL)
+	if _, err := json.Marshal(hash); err == nil {
+		t.Errorf("expected error marshalling keys 1 and \"1\"")
+	}
+	nested.Delete(&String{Value: "1"})
+
+	nested.Set(TRUE, &Builtin{})
+	if _, err := json.Marshal(hash); err == nil {
+		t.Errorf("expected error marshalling BUILTIN")
+	}
+}
+
+func TestHashDelete(t *testing.T) {
+	hash := NewHash()
+	for i := 0; i < 10; i++ {
+		hash.Set(&Integer{Value: int64(i)}, &Integer{Value: int64(i * i)})
+	}
+
+	// enough to compact, which mustn't lose the order of what's left
+	for _, i := range []int64{0, 2, 4, 5, 6, 8} {
+		if !hash.Delete(&Integer{Value: i}) {
+			t.Errorf("Delete(%d) found nothing", i)
+		}
+	}
+	if hash.Delete(&Integer{Value: 2}) {
+		t.Errorf("Delete(2) twice found something")
+	}
+	hash.Set(&Integer{Value: 0}, TRUE)
+
+	expected := "{1: 1, 3: 9, 7: 49, 9: 81, 0: true}"
+	if hash.Inspect() != expected || hash.Len() != 5 {
+		t.Errorf("wrong hash. want=%q, got=%q (len %d)", expected, hash.Inspect(), hash.Len())
+	}
+	if value, ok := hash.Get(&Integer{Value: 7}); !ok || value.Inspect() != "49" {
+		t.Errorf("wrong value for 7. got=%v", value)
+	}
+}
+
+func TestArrayPersistence(t *testing.T) {
+	// enough elements for three levels of trie
+	versions := []*Array{NewArray(nil)}
+	for i := 0; i < 2000; i++ {
+		versions = append(versions, versions[i].Push(&Integer{Value: int64(i)}))
+	}
+
+	for n, array := range versions {
+		if array.Len() != n {
+			t.Fatalf("version %d has wrong length. got=%d", n, array.Len())
+		}
+		if n > 0 {
+			if last, _ := array.At(n - 1); last.(*Integer).Value != int64(n-1) {
+				t.Fatalf("version %d has wrong last element. got=%s", n, last.Inspect())
+			}
+		}
+	}
+
+	last := versions[len(versions)-1]
+	changed := last.With(1500, TRUE).Rest()
+	if elem, _ := changed.At(1499); elem != TRUE {
+		t.Errorf("With didn't change element. got=%s", elem.Inspect())
+	}
+	if elem, _ := last.At(1500); elem == TRUE {
+		t.Errorf("With changed the array it was made from")
+	}
+
+	// pushing onto a shortened array mustn't write over the longer one
+	popped := NewArray(last.Elements())
+	popped.Pop()
+	pushed := popped.Push(FALSE)
+	if elem, _ := last.At(1999); elem == FALSE {
+		t.Errorf("Push after Pop changed the array it was made from")
+	}
+	if elem, _ := pushed.At(1999); elem != FALSE {
+		t.Errorf("Push after Pop didn't push. got=%s", elem.Inspect())
+	}
+
+	for i, elem := range changed.Elements() {
+		if i == 1499 {
+			continue
+		}
+		want := int64(i + 1)
+		if elem.(*Integer).Value != want {
+			t.Fatalf("element %d of Rest is wrong. want=%d, got=%s", i, want, elem.Inspect())
+		}
+	}
+}
+
+func TestArrayElements(t *testing.T) {
+	elements := []Object{&Integer{Value: 1}, &Integer{Value: 2}}
+	array := NewArray(elements)
+	elements[0] = TRUE
+	if elem, _ := array.At(0); elem == TRUE {
+		t.Errorf("changing the slice given to NewArray changed the array")
+	}
+
+	got := array.Elements()
+	got[1] = FALSE
+	if elem, _ := array.At(1); elem == FALSE {
+		t.Errorf("changing the slice from Elements changed the array")
+	}
+	if len(got) != array.Len() {
+		t.Errorf("wrong number of elements. want=%d, got=%d", array.Len(), len(got))
+	}
+}
+
+func TestArrayQueue(t *testing.T) {
+	queue := NewArray([]Object{})
+	for i := 0; i < 100000; i++ {
+		queue = queue.Push(&Integer{Value: int64(i)})
+		if i >= 10 {
+			queue = queue.Rest()
+		}
+	}
+
+	if queue.Len() != 10 {
+		t.Fatalf("wrong length. want=10, got=%d", queue.Len())
+	}
+	if first, _ := queue.At(0); first.(*Integer).Value != 99990 {
+		t.Errorf("wrong first element. want=99990, got=%s", first.Inspect())
+	}
+	if queue.elements.count > 2*vectorWidth {
+		t.Errorf("dropped elements still held. trie has %d", queue.elements.count)
+	}
+}
+
+func TestHashPersistence(t *testing.T) {
+	hash := NewHash()
+	for i := 0; i < 1000; i++ {
+		hash.Set(&Integer{Value: int64(i)}, &Integer{Value: int64(i * i)})
+	}
+
+	with, _ := hash.With(&Integer{Value: 500}, TRUE)
+	without := with.Without(&Integer{Value: 10})
+
+	if value, _ := hash.Get(&Integer{Value: 500}); value.Inspect() != "250000" {
+		t.Errorf("With changed the hash it was made from. got=%s", value.Inspect())
+	}
+	if _, ok := with.Get(&Integer{Value: 10}); !ok {
+		t.Errorf("Without changed the hash it was made from")
+	}
+	if value, _ := without.Get(&Integer{Value: 500}); value != TRUE {
+		t.Errorf("wrong value for 500. got=%v", value)
+	}
+	if _, ok := without.Get(&Integer{Value: 10}); ok || without.Len() != 999 {
+		t.Errorf("Without didn't remove 10. len=%d", without.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		if value, ok := hash.Get(&Integer{Value: int64(i)}); !ok || value.(*Integer).Value != int64(i*i) {
+			t.Fatalf("wrong value for %d. got=%v", i, value)
+		}
+	}
+}
+
+func TestCyclicValues(t *testing.T) {
+	array := NewArray([]Object{&Integer{Value: 1}})
+	array.Append(array)
+	hash := NewHash()
+	hash.Set(&String{Value: "self"}, hash)
+	hash.Set(&String{Value: "array"}, array)
+
+	expected := "{self: {...}, array: [1, [...]]}"
+	if hash.Inspect() != expected {
+		t.Errorf("wrong Inspect. want=%q, got=%q", expected, hash.Inspect())
+	}
+
+	_, err := json.Marshal(array)
+	if err == nil || !strings.Contains(err.Error(), "cyclic ARRAY can't be written as JSON") {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestMeter(t *testing.T) {
+	s := &String{Value: "abcd"}
+	array := NewArray([]Object{s, s, &Integer{Value: 1}})
+
+	m := NewMeter()
+	m.Object(array)
+	expected := int64((24 + 3*16) + (16 + 4))
+	if m.Bytes() != expected {
+		t.Errorf("wrong bytes. want=%d, got=%d", expected, m.Bytes())
+	}
+
+	// rest shares the trie, so only adds its own header
+	m.Object(array.Rest())
+	if m.Bytes() != expected+24 {
+		t.Errorf("wrong bytes after rest. want=%d, got=%d", expected+24, m.Bytes())
+	}
+
+	cyclic := NewHash()
+	cyclic.Set(&String{Value: "self"}, cyclic)
+	m = NewMeter()
+	m.Object(cyclic)
+	expected = int64((48 + 64) + (16 + 4))
+	if m.Bytes() != expected {
+		t.Errorf("wrong bytes for cyclic hash. want=%d, got=%d", expected, m.Bytes())
+	}
+
+	env := NewEnvironment()
+	env.Set("s", s)
+	inner := NewEnclosedEnvironment(env)
+	inner.Set("t", s)
+	m = NewMeter()
+	m.Environment(inner)
+	if m.Bytes() != 16+4 {
+		t.Errorf("wrong bytes for environment. want=%d, got=%d", 16+4, m.Bytes())
+	}
+}
+
+func TestHashKeyOf(t *testing.T) {
+	one := &Integer{Value: 1}
+	two := &String{Value: "two"}
+
+	ab := NewHash()
+	ab.Set(one, two)
+	ab.Set(two, one)
+	ba := NewHash()
+	ba.Set(two, one)
+	ba.Set(one, two)
+
+	cyclic := NewArray([]Object{one})
+	cyclic.Append(cyclic)
+
+	same := [][2]Object{
+		{NewArray([]Object{one, two}), NewArray([]Object{&Integer{Value: 1}, &String{Value: "two"}})},
+		{ab, ba},
+		{NewArray([]Object{ab}), NewArray([]Object{ba})},
+	}
+	for i, tt := range same {
+		k1, ok1 := HashKeyOf(tt[0])
+		k2, ok2 := HashKeyOf(tt[1])
+		if !ok1 || !ok2 || k1 != k2 {
+			t.Errorf("same[%d] have distinct hash keys", i)
+		}
+	}
+
+	k1, _ := HashKeyOf(NewArray([]Object{one, two}))
+	k2, _ := HashKeyOf(NewArray([]Object{two, one}))
+	if k1 == k2 {
+		t.Errorf("arrays in different orders have same hash key")
+	}
+
+	for _, key := range []Object{NULL, NewArray([]Object{NULL}), cyclic} {
+		if _, ok := HashKeyOf(key); ok {
+			t.Errorf("%s is usable as hash key", key.Type())
+		}
+	}
+}
+
+func TestErrorInspect(t *testing.T) {
+	err := &Error{
+		Message: "type mismatch: INTEGER + BOOLEAN",
+		Trace: []Frame{
+			{Function: "inner", Args: []string{"1"}, Line: 2, Column: 29},
+			{Function: "<composed>", Args: []string{"1", `"two"`}},
+		},
+	}
+
+	expected := "ERROR: type mismatch: INTEGER + BOOLEAN\n" +
+		"\tat inner(1) (line 2, column 29)\n" +
+		"\tat <composed>(1, \"two\")"
+
+	if err.Inspect() != expected {
+		t.Errorf("wrong Inspect. want=%q, got=%q", expected, err.Inspect())
+	}
+}
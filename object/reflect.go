@@ -0,0 +1,117 @@
+package object
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// FuncBuiltin wraps fn, an ordinary Go function such as
+// func(string, int) (string, error), as a builtin called name. Arguments are
+// converted to fn's parameter types and its result back to a Monkey value; a
+// non-nil error as fn's last result becomes the builtin's error instead. Return
+// an *Error to give it a kind.
+// Parameters and results may be of any type FromGo and ToGo convert.
+func FuncBuiltin(name string, doc string, fn interface{}) (BuiltinDefinition, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return BuiltinDefinition{}, fmt.Errorf("builtin `%s` must be a function, got %T", name, fn)
+	}
+
+	t := v.Type()
+	if err := checkFuncType(t, fmt.Sprintf("builtin `%s`", name)); err != nil {
+		return BuiltinDefinition{}, err
+	}
+
+	results := t.NumOut()
+	returnsError := results > 0 && t.Out(results-1) == errorType
+	if returnsError {
+		results--
+	}
+
+	arity := t.NumIn()
+	if t.IsVariadic() {
+		arity = VariadicArity
+	}
+
+	builtin := &Builtin{Fn: func(args ...Object) (result Object) {
+		if t.IsVariadic() && len(args) < t.NumIn()-1 {
+			return newError(ARITY_ERROR, "wrong number of arguments. got=%d, expected at least %d", len(args), t.NumIn()-1)
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			value, err := toGo(arg, paramType(t, i), fmt.Sprintf("argument %d to `%s`", i+1, name))
+			if err != nil {
+				return errorObject(err)
+			}
+			in[i] = value
+		}
+
+		// funcs made by ToGo with no error result panic with the errors of
+		// the functions they call, which are this builtin's errors too
+		defer func() {
+			if r := recover(); r != nil {
+				err, ok := r.(*Error)
+				if !ok {
+					panic(r)
+				}
+				result = err
+			}
+		}()
+
+		out := v.Call(in)
+
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return errorObject(err)
+			}
+		}
+		if results == 0 {
+			return NULL
+		}
+
+		converted, err := fromGo(out[0], fmt.Sprintf("result of `%s`", name), map[uintptr]bool{})
+		if err != nil {
+			return errorObject(err)
+		}
+		return converted
+	}}
+
+	return BuiltinDefinition{Name: name, Builtin: builtin, Arity: arity, Doc: doc}, nil
+}
+
+// paramType is the type of the i-th argument, which for variadic functions
+// may be one of the variadic ones.
+func paramType(t reflect.Type, i int) reflect.Type {
+	if t.IsVariadic() && i >= t.NumIn()-1 {
+		return t.In(t.NumIn() - 1).Elem()
+	}
+	return t.In(i)
+}
+
+// errorObject turns err into a Monkey error, keeping its kind if it already
+// is one.
+func errorObject(err error) *Error {
+	if err, ok := err.(*Error); ok {
+		return err
+	}
+	return newError(DefaultErrorKind, "%s", err)
+}
+
+// objectTypeOf names the Monkey type a Go type implementing Object stands for.
+func objectTypeOf(t reflect.Type) ObjectType {
+	if t.Kind() == reflect.Interface {
+		return ObjectType(strings.ToUpper(t.Name()))
+	}
+	return reflect.Zero(t).Interface().(Object).Type()
+}
+
+func mismatch(path string, expected ObjectType, got Object) error {
+	return newError(TYPE_ERROR, "%s must be %s, got=%s", path, expected, got.Type())
+}
@@ -0,0 +1,104 @@
+package object
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFuncBuiltin(t *testing.T) {
+	repeat, err := FuncBuiltin("repeat", "", func(s string, n int) (string, error) {
+		if n < 0 {
+			return "", errors.New("can't repeat a negative number of times")
+		}
+		return strings.Repeat(s, n), nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sum, _ := FuncBuiltin("sum", "", func(xs ...uint8) int {
+		total := 0
+		for _, x := range xs {
+			total += int(x)
+		}
+		return total
+	})
+	kind, _ := FuncBuiltin("kind", "", func(obj Object, flag bool) *String {
+		return &String{Value: string(obj.Type())}
+	})
+	nothing, _ := FuncBuiltin("nothing", "", func() {})
+	apply, _ := FuncBuiltin("apply", "", func(f func(int) int, n int) int { return f(n) })
+	double := &Builtin{Fn: func(args ...Object) Object {
+		return &Integer{Value: args[0].(*Integer).Value * 2}
+	}}
+	fail := &Builtin{Fn: func(args ...Object) Object {
+		return newError(VALUE_ERROR, "division by zero")
+	}}
+
+	if repeat.Arity != 2 || sum.Arity != VariadicArity || nothing.Arity != 0 {
+		t.Errorf("wrong arities. got=%d, %d, %d", repeat.Arity, sum.Arity, nothing.Arity)
+	}
+
+	tests := []struct {
+		builtin  BuiltinDefinition
+		args     []Object
+		expected interface{}
+	}{
+		{repeat, []Object{&String{Value: "ab"}, &Integer{Value: 3}}, "ababab"},
+		{repeat, []Object{&String{Value: "ab"}, &Integer{Value: -1}}, errors.New("can't repeat a negative number of times")},
+		{repeat, []Object{&Integer{Value: 1}, &Integer{Value: 1}}, errors.New("argument 1 to `repeat` must be STRING, got=INTEGER")},
+		{sum, []Object{}, int64(0)},
+		{sum, []Object{&Integer{Value: 1}, &Integer{Value: 2}}, int64(3)},
+		{sum, []Object{&Integer{Value: 256}}, errors.New("argument 1 to `sum` is out of range for uint8, got=256")},
+		{kind, []Object{&Array{}, TRUE}, "ARRAY"},
+		{kind, []Object{&Array{}, NULL}, errors.New("argument 2 to `kind` must be BOOLEAN, got=NULL")},
+		{nothing, []Object{}, nil},
+		{apply, []Object{double, &Integer{Value: 21}}, int64(42)},
+		{apply, []Object{fail, &Integer{Value: 21}}, errors.New("division by zero")},
+	}
+
+	for _, tt := range tests {
+		result := tt.builtin.Builtin.Fn(tt.args...)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			str, ok := result.(*String)
+			if !ok || str.Value != expected {
+				t.Errorf("wrong result from %s. want=%q, got=%+v", tt.builtin.Name, expected, result)
+			}
+		case int64:
+			integer, ok := result.(*Integer)
+			if !ok || integer.Value != expected {
+				t.Errorf("wrong result from %s. want=%d, got=%+v", tt.builtin.Name, expected, result)
+			}
+		case error:
+			errObj, ok := result.(*Error)
+			if !ok || errObj.Message != expected.Error() {
+				t.Errorf("wrong error from %s. want=%q, got=%+v", tt.builtin.Name, expected, result)
+			}
+		case nil:
+			if result != NULL {
+				t.Errorf("wrong result from %s. want=NULL, got=%+v", tt.builtin.Name, result)
+			}
+		}
+	}
+}
+
+func TestFuncBuiltinUnsupported(t *testing.T) {
+	tests := []struct {
+		fn       interface{}
+		expected string
+	}{
+		{42, "builtin `f` must be a function, got int"},
+		{func(x complex128) {}, "builtin `f` has unsupported parameter type complex128"},
+		{func() (int, int) { return 0, 0 }, "builtin `f` has unsupported results func() (int, int)"},
+		{func() chan int { return nil }, "builtin `f` has unsupported results func() chan int"},
+	}
+
+	for _, tt := range tests {
+		_, err := FuncBuiltin("f", "", tt.fn)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package object
+
+// Set is a collection of distinct values, kept in the order they were first
+// added. Its elements are stored as the keys of a Hash, so anything usable as
+// a hash key can be an element. The zero Set is empty and ready to use.
+type Set struct {
+	elements Hash
+}
+
+func NewSet() *Set {
+	return &Set{}
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+func (s *Set) Inspect() string  { return inspect(s, make(map[Object]bool)) }
+
+// Len is the number of elements in s.
+func (s *Set) Len() int { return s.elements.Len() }
+
+// Add puts elem in s if it isn't already. It reports false, and leaves s
+// alone, if elem can't be used as a hash key.
+func (s *Set) Add(elem Object) bool {
+	if _, ok := s.elements.Get(elem); ok {
+		return true
+	}
+	return s.elements.Set(elem, TRUE)
+}
+
+// Contains reports whether elem is in s.
+func (s *Set) Contains(elem Object) bool {
+	_, ok := s.elements.Get(elem)
+	return ok
+}
+
+// Elements returns the elements of s in order.
+func (s *Set) Elements() []Object {
+	return s.elements.Keys()
+}
+
+// Union returns a new set of the elements of s followed by those of other.
+func (s *Set) Union(other *Set) *Set {
+	result := NewSet()
+	for _, elem := range s.Elements() {
+		result.Add(elem)
+	}
+	for _, elem := range other.Elements() {
+		result.Add(elem)
+	}
+	return result
+}
+
+// Intersection returns a new set of the elements of s that are also in other.
+func (s *Set) Intersection(other *Set) *Set {
+	result := NewSet()
+	for _, elem := range s.Elements() {
+		if other.Contains(elem) {
+			result.Add(elem)
+		}
+	}
+	return result
+}
+
+// Difference returns a new set of the elements of s that aren't in other.
+func (s *Set) Difference(other *Set) *Set {
+	result := NewSet()
+	for _, elem := range s.Elements() {
+		if !other.Contains(elem) {
+			result.Add(elem)
+		}
+	}
+	return result
+}
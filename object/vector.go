@@ -0,0 +1,191 @@
+package object
+
+// vector is a persistent sequence: "changing" one makes a new vector sharing
+// all but O(log n) of the old one, which is left as it was. Items live in the
+// leaves of a trie 32 wide, found by the bits of their position five at a
+// time, so a million items are at most four levels down.
+//
+// A vector is a window [start, end) onto its trie, so dropping items from
+// either end is just moving the window, until most of the trie is outside
+// it, and pushing onto a window that ends short of the trie overwrites what's
+// past it. The zero vector is empty.
+type vector[T any] struct {
+	root  *vectorNode[T]
+	shift uint // of the root's level; 0 when the root is a leaf
+	count int  // items in the trie
+	start int
+	end   int
+}
+
+type vectorNode[T any] struct {
+	children []*vectorNode[T] // for branches
+	items    []T              // for leaves
+}
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+// newVector makes a vector of items, building the trie a level at a time.
+func newVector[T any](items []T) vector[T] {
+	if len(items) == 0 {
+		return vector[T]{}
+	}
+
+	nodes := []*vectorNode[T]{}
+	for i := 0; i < len(items); i += vectorWidth {
+		end := min(i+vectorWidth, len(items))
+		nodes = append(nodes, &vectorNode[T]{items: append([]T{}, items[i:end]...)})
+	}
+
+	shift := uint(0)
+	for len(nodes) > 1 {
+		parents := []*vectorNode[T]{}
+		for i := 0; i < len(nodes); i += vectorWidth {
+			end := min(i+vectorWidth, len(nodes))
+			parents = append(parents, &vectorNode[T]{children: append([]*vectorNode[T]{}, nodes[i:end]...)})
+		}
+		nodes = parents
+		shift += vectorBits
+	}
+
+	return vector[T]{root: nodes[0], shift: shift, count: len(items), end: len(items)}
+}
+
+func (v vector[T]) len() int { return v.end - v.start }
+
+// at returns the item at i, which must be in range.
+func (v vector[T]) at(i int) T {
+	index := v.start + i
+	return v.leaf(index).items[index&vectorMask]
+}
+
+// leaf returns the leaf holding the item at index in the trie.
+func (v vector[T]) leaf(index int) *vectorNode[T] {
+	node := v.root
+	for shift := v.shift; shift > 0; shift -= vectorBits {
+		node = node.children[(index>>shift)&vectorMask]
+	}
+	return node
+}
+
+// each calls fn with the items in order, a leaf at a time.
+func (v vector[T]) each(fn func(i int, item T)) {
+	for index := v.start; index < v.end; {
+		leaf := v.leaf(index)
+		for j := index & vectorMask; j < len(leaf.items) && index < v.end; j++ {
+			fn(index-v.start, leaf.items[j])
+			index++
+		}
+	}
+}
+
+func (v vector[T]) slice() []T {
+	items := make([]T, v.len())
+	v.each(func(i int, item T) { items[i] = item })
+	return items
+}
+
+// set returns v with the item at i, which must be in range, replaced.
+func (v vector[T]) set(i int, item T) vector[T] {
+	v.root = v.root.set(v.shift, v.start+i, item)
+	return v
+}
+
+// push returns v with item added to the end.
+func (v vector[T]) push(item T) vector[T] {
+	switch {
+	case v.end < v.count:
+		v.root = v.root.set(v.shift, v.end, item)
+
+	case v.root == nil:
+		v.root = &vectorNode[T]{items: []T{item}}
+		v.count++
+
+	case v.count == 1<<(v.shift+vectorBits):
+		// the trie is full, so it goes under a new root
+		v.root = &vectorNode[T]{children: []*vectorNode[T]{v.root, newVectorPath(v.shift, item)}}
+		v.shift += vectorBits
+		v.count++
+
+	default:
+		v.root = v.root.push(v.shift, v.count, item)
+		v.count++
+	}
+
+	v.end++
+	return v
+}
+
+// rest returns v without its first item, if it has one.
+func (v vector[T]) rest() vector[T] {
+	if v.len() <= 1 {
+		return vector[T]{}
+	}
+	v.start++
+	return v.compact()
+}
+
+// pop returns v without its last item, if it has one.
+func (v vector[T]) pop() vector[T] {
+	if v.len() <= 1 {
+		return vector[T]{}
+	}
+	v.end--
+	return v.compact()
+}
+
+// compact rebuilds v's trie from just its items once most of the trie is
+// items outside its window, so a queue made by pushing onto one end and
+// dropping from the other doesn't hold on to everything it ever held.
+// Rebuilding takes O(n), but only after n/2 items have been dropped.
+func (v vector[T]) compact() vector[T] {
+	if v.count <= vectorWidth || v.len() > v.count/2 {
+		return v
+	}
+	return newVector(v.slice())
+}
+
+func (n *vectorNode[T]) set(shift uint, index int, item T) *vectorNode[T] {
+	if shift == 0 {
+		items := append([]T{}, n.items...)
+		items[index&vectorMask] = item
+		return &vectorNode[T]{items: items}
+	}
+
+	children := append([]*vectorNode[T]{}, n.children...)
+	i := (index >> shift) & vectorMask
+	children[i] = children[i].set(shift-vectorBits, index, item)
+	return &vectorNode[T]{children: children}
+}
+
+// push adds item at index, the first place past the end of n's subtrie,
+// which has room for it.
+func (n *vectorNode[T]) push(shift uint, index int, item T) *vectorNode[T] {
+	if shift == 0 {
+		items := make([]T, len(n.items)+1)
+		copy(items, n.items)
+		items[len(n.items)] = item
+		return &vectorNode[T]{items: items}
+	}
+
+	i := (index >> shift) & vectorMask
+	children := make([]*vectorNode[T], len(n.children), len(n.children)+1)
+	copy(children, n.children)
+	if i < len(children) {
+		children[i] = children[i].push(shift-vectorBits, index, item)
+	} else {
+		children = append(children, newVectorPath(shift-vectorBits, item))
+	}
+	return &vectorNode[T]{children: children}
+}
+
+// newVectorPath makes a subtrie holding just item, with its leaf shift above.
+func newVectorPath[T any](shift uint, item T) *vectorNode[T] {
+	if shift == 0 {
+		return &vectorNode[T]{items: []T{item}}
+	}
+	return &vectorNode[T]{children: []*vectorNode[T]{newVectorPath(shift-vectorBits, item)}}
+}
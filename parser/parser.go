@@ -11,8 +11,11 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	PIPE
+	COMPOSE
 	EQUALS
 	LESSGREATER
+	RANGE
 	SUM
 	PRODUCT
 	PREFIX
@@ -21,16 +24,22 @@ const (
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQUAL:     EQUALS,
-	token.NOT_EQUAL: EQUALS,
-	token.LT:        LESSGREATER,
-	token.GT:        LESSGREATER,
-	token.PLUS:      SUM,
-	token.MINUS:     SUM,
-	token.DIVIDE:    PRODUCT,
-	token.MULTIPLY:  PRODUCT,
-	token.LPAREN:    CALL,
-	token.LBRACKET:  INDEX,
+	token.PIPE:            PIPE,
+	token.COMPOSE:         COMPOSE,
+	token.EQUAL:           EQUALS,
+	token.NOT_EQUAL:       EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.IN:              LESSGREATER,
+	token.RANGE:           RANGE,
+	token.RANGE_INCLUSIVE: RANGE,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.DIVIDE:          PRODUCT,
+	token.MULTIPLY:        PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
+	token.DOT:             INDEX,
 }
 
 // expression helper things :3
@@ -58,6 +67,10 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// grouped is the last expression parsed in parentheses, which a pipe
+	// calls rather than adding its left side to, if it's a call itself
+	grouped ast.Expression
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -76,21 +89,31 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.FOR, p.parseForExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.SET, p.parseSetLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
+	p.registerInfix(token.PIPE, p.parsePipeExpression)
+	p.registerInfix(token.COMPOSE, p.parseInfixExpression)
 	p.registerInfix(token.EQUAL, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQUAL, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression)
+	p.registerInfix(token.RANGE, p.parseInfixExpression)
+	p.registerInfix(token.RANGE_INCLUSIVE, p.parseInfixExpression)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.MULTIPLY, p.parseInfixExpression)
 	p.registerInfix(token.DIVIDE, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -125,6 +148,12 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -171,6 +200,58 @@ func (p *Parser) parseLetStatement() ast.Statement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	for p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.AS) || !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	for p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LET) {
+		return nil
+	}
+
+	let, ok := p.parseLetStatement().(*ast.LetStatement)
+	if !ok {
+		return nil
+	}
+	stmt.Let = let
+
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() ast.Statement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -178,7 +259,7 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	for p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -220,20 +301,91 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	return expr
 }
 
+// parseGroupedExpression also handles the parameter list of an arrow function.
+// A `()` or a comma inside the parens can only be a parameter list, and a lone
+// `(x)` becomes one when it is followed by `=>`.
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+		return p.parseArrowFunction([]*ast.Identifier{})
+	}
+
 	p.nextToken()
 
 	expr := p.parseExpression(LOWEST)
+	if !p.peekTokenIs(token.COMMA) {
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+
+		ident, ok := expr.(*ast.Identifier)
+		if !ok || !p.peekTokenIs(token.ARROW) {
+			p.grouped = expr
+			return expr
+		}
+
+		p.nextToken()
+		return p.parseArrowFunction([]*ast.Identifier{ident})
+	}
+
+	exprs := []ast.Expression{expr}
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		exprs = append(exprs, p.parseExpression(LOWEST))
+	}
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
 
-	return expr
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	params := []*ast.Identifier{}
+	for _, expr := range exprs {
+		ident, ok := expr.(*ast.Identifier)
+		if !ok {
+			p.invalidParameterError(expr)
+			return nil
+		}
+		params = append(params, ident)
+	}
+
+	return p.parseArrowFunction(params)
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.ARROW) {
+		p.nextToken()
+		return p.parseArrowFunction([]*ast.Identifier{ident})
+	}
+
+	return ident
+}
+
+// parseArrowFunction parses the body of `params => expr` into a FunctionLiteral
+// whose block holds the single expression.
+func (p *Parser) parseArrowFunction(params []*ast.Identifier) ast.Expression {
+	literal := &ast.FunctionLiteral{Token: p.curToken, Parameters: params}
+
+	p.nextToken()
+
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	stmt.Expression = p.parseExpression(LOWEST)
+	if stmt.Expression == nil {
+		return nil
+	}
+
+	literal.Body = &ast.BlockStatement{Token: literal.Token, Statements: []ast.Statement{stmt}}
+
+	return literal
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
@@ -265,6 +417,12 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	return array
 }
 
+func (p *Parser) parseSetLiteral() ast.Expression {
+	set := &ast.SetLiteral{Token: p.curToken}
+	set.Elements = p.parseExpressionList(token.RBRACE)
+	return set
+}
+
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
@@ -281,6 +439,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -321,6 +480,23 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expr
 }
 
+// parsePipeExpression desugars `x |> f(a)` into `f(x, a)` and `x |> f` into
+// `f(x)`, so the evaluator only ever sees ordinary calls.
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+	right := p.parseExpression(precedence)
+
+	if call, ok := right.(*ast.CallExpression); ok && right != p.grouped {
+		call.Arguments = append([]ast.Expression{left}, call.Arguments...)
+		return call
+	}
+
+	return &ast.CallExpression{Token: tok, Function: right, Arguments: []ast.Expression{left}}
+}
+
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	expr := &ast.IndexExpression{Token: p.curToken, Left: left}
 	p.nextToken()
@@ -333,6 +509,18 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return expr
 }
 
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	expr := &ast.MemberExpression{Token: p.curToken, Object: left}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	expr.Member = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return expr
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
 	expr := &ast.IfExpression{Token: p.curToken}
 
@@ -366,6 +554,83 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expr
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expr := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expr.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		expr.Parameter = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expr.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expr.Finally = p.parseBlockStatement()
+	}
+
+	if expr.Catch == nil && expr.Finally == nil {
+		msg := fmt.Sprintf("expected next token to be 'CATCH' or 'FINALLY'. got='%s'", p.peekToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	return expr
+}
+
+func (p *Parser) parseForExpression() ast.Expression {
+	expr := &ast.ForExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	expr.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	expr.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expr.Body = p.parseBlockStatement()
+
+	return expr
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	literal := &ast.FunctionLiteral{Token: p.curToken}
 
@@ -384,6 +649,24 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return literal
 }
 
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	literal := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	literal.Parameters = p.parseFunctionParams()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	literal.Body = p.parseBlockStatement()
+
+	return literal
+}
+
 func (p *Parser) parseFunctionParams() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 
@@ -485,6 +768,11 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+func (p *Parser) invalidParameterError(expr ast.Expression) {
+	msg := fmt.Sprintf("invalid arrow function parameter: %s", expr.String())
+	p.errors = append(p.errors, msg)
+}
+
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
 	p.errors = append(p.errors, msg)
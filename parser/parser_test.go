@@ -76,6 +76,25 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestReturnStatementWithoutSemicolon(t *testing.T) {
+	input := `if (x) { return 5 } return y`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	returnStmt, ok := program.Statements[1].(*ast.ReturnStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ReturnStatement. got=%T", program.Statements[1])
+	}
+	testLiteralExpression(t, returnStmt.ReturnValue, "y")
+}
+
 // expressions :)
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
@@ -190,6 +209,37 @@ func TestArrayLiterals(t *testing.T) {
 	testInfixExpression(t, array.Elements[2], 3, "+", 3)
 }
 
+func TestSetLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`#{1, 2 * 2, "three"}`, `#{1, (2 * 2), three}`},
+		{`#{}`, `#{}`},
+		{`#{#{1}, [2], {3: 4}}`, `#{#{1}, [2], {3:4}}`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		if _, ok := stmt.Expression.(*ast.SetLiteral); !ok {
+			t.Fatalf("expression not ast.SetLiteral. got=%T", stmt.Expression)
+		}
+
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, stmt.Expression.String())
+		}
+	}
+}
+
 func TestIndexExpression(t *testing.T) {
 	input := `arr[1 + 1]`
 
@@ -221,6 +271,159 @@ func TestIndexExpression(t *testing.T) {
 	}
 }
 
+func TestMemberExpression(t *testing.T) {
+	input := `lib.helper`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	expr, ok := stmt.Expression.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("expression not ast.MemberExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, expr.Object, "lib") {
+		return
+	}
+
+	if !testIdentifier(t, expr.Member, "helper") {
+		return
+	}
+}
+
+func TestImportAndExportStatements(t *testing.T) {
+	input := `import "lib/util.mk" as util;
+export let x = util.y;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program has wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	imp, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ImportStatement. got=%T", program.Statements[0])
+	}
+	if imp.Path.Value != "lib/util.mk" {
+		t.Errorf("import path wrong. got=%q", imp.Path.Value)
+	}
+	if !testIdentifier(t, imp.Name, "util") {
+		return
+	}
+
+	exp, ok := program.Statements[1].(*ast.ExportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not ast.ExportStatement. got=%T", program.Statements[1])
+	}
+	if !testLetStatement(t, exp.Let, "x") {
+		return
+	}
+
+	if program.String() != `import "lib/util.mk" as util;export let x = (util.y);` {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { f() } catch (e) { e }`, "try f() catch (e) e"},
+		{`try { f() } finally { g() }`, "try f() finally g()"},
+		{`try { f() } catch (err) { 1 } finally { g() }`, "try f() catch (err) 1 finally g()"},
+		{`throw "bad"`, "throw bad;"},
+		{`if (x) { throw x + 1; }`, "ifx throw (x + 1);"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has wrong number of statements. got=%d", len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("wrong program. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New(`try { a } catch (e) { b } finally { c }`)).ParseProgram()
+	expr, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("expression is not ast.TryExpression. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	if !testIdentifier(t, expr.Parameter, "e") {
+		return
+	}
+	if len(expr.Block.Statements) != 1 || len(expr.Catch.Statements) != 1 || len(expr.Finally.Statements) != 1 {
+		t.Errorf("blocks have wrong number of statements. got=%d, %d, %d",
+			len(expr.Block.Statements), len(expr.Catch.Statements), len(expr.Finally.Statements))
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { a }`, "expected next token to be 'CATCH' or 'FINALLY'. got='EOF'"},
+		{`try { a } catch { b }`, "expected next token to be '('. got='{'"},
+		{`try { a } catch (1) { b }`, "expected next token to be 'IDENT'. got='INT'"},
+		{`try a`, "expected next token to be '{'. got='IDENT'"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestImportAndExportErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import lib as lib`, "expected next token to be 'STRING'. got='IDENT'"},
+		{`import "lib.mk" lib`, "expected next token to be 'AS'. got='IDENT'"},
+		{`import "lib.mk" as "lib"`, "expected next token to be 'IDENT'. got='STRING'"},
+		{`export x`, "expected next token to be 'LET'. got='IDENT'"},
+		{`lib.1`, "expected next token to be 'IDENT'. got='INT'"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestHashLiteralStrings(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 	expected := map[string]int64{
@@ -446,6 +649,9 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
+		{"0..10", 0, "..", 10},
+		{"0..=10", 0, "..=", 10},
+		{"x in xs", "x", "in", "xs"},
 	}
 
 	for _, tt := range infixTests {
@@ -566,6 +772,41 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestForExpression(t *testing.T) {
+	input := `for (x in xs) { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Body does not contain 1 statements. got=%d\n", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.ForExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ForExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Variable, "x") {
+		return
+	}
+
+	if !testIdentifier(t, exp.Iterable, "xs") {
+		return
+	}
+
+	if len(exp.Body.Statements) != 1 {
+		t.Errorf("body is not 1 statements. got=%d\n", len(exp.Body.Statements))
+	}
+}
+
 // function things :)
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
@@ -608,6 +849,112 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestArrowFunctionParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+		expectedBody   string
+	}{
+		{"x => x * 2", []string{"x"}, "(x * 2)"},
+		{"(x) => x * 2", []string{"x"}, "(x * 2)"},
+		{"(a, b) => a + b", []string{"a", "b"}, "(a + b)"},
+		{"() => 1", []string{}, "1"},
+		{"x => y => x + y", []string{"x"}, "fn(y) (x + y)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+		}
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n", len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+
+		if len(function.Body.Statements) != 1 {
+			t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n", len(function.Body.Statements))
+		}
+
+		if function.Body.String() != tt.expectedBody {
+			t.Errorf("body wrong. want=%q, got=%q", tt.expectedBody, function.Body.String())
+		}
+	}
+}
+
+func TestArrowFunctionParsingErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(a, 1) => a", "invalid arrow function parameter: 1"},
+		{"(a, b)", "expected next token to be '=>'. got='EOF'"},
+		{"()", "expected next token to be '=>'. got='EOF'"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong parser errors. want=%q, got=%q", tt.expected, errors)
+		}
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n", len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n", len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T", macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -833,10 +1180,70 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a * [1, 2, 3, 4][b * c] * d",
 			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
 		},
+		{
+			"-lib.x * lib.f(a)[0]",
+			"((-(lib.x)) * ((lib.f)(a)[0]))",
+		},
 		{
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"xs.map(f).filter(g)[0]",
+			"(((xs.map)(f).filter)(g)[0])",
+		},
+		{
+			"0..n + 1",
+			"(0 .. (n + 1))",
+		},
+		{
+			"a..b == c..=d",
+			"((a .. b) == (c ..= d))",
+		},
+		{
+			"x + 1 in 0..10",
+			"((x + 1) in (0 .. 10))",
+		},
+		{
+			"xs |> sum",
+			"sum(xs)",
+		},
+		{
+			"xs |> map(f) |> filter(g) |> sum",
+			"sum(filter(map(xs, f), g))",
+		},
+		{
+			"a + b |> f(c == d)",
+			"f((a + b), (c == d))",
+		},
+		{
+			"xs |> f >> g",
+			"(f >> g)(xs)",
+		},
+		{
+			"f >> g >> h",
+			"((f >> g) >> h)",
+		},
+		{
+			"(a + b) * c",
+			"((a + b) * c)",
+		},
+		{
+			"map(xs, x => x * 2)",
+			"map(xs, fn(x) (x * 2))",
+		},
+		{
+			"xs |> reduce((a, b) => a + b, 0)",
+			"reduce(xs, fn(a, b) (a + b), 0)",
+		},
+		{
+			"5 |> (add(1))",
+			"add(1)(5)",
+		},
+		{
+			"5 |> (add)(1)",
+			"add(5, 1)",
+		},
 	}
 
 	for _, tt := range tests {
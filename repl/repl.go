@@ -4,13 +4,21 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/compiler"
 	"monkey/eval"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/vm"
 )
 
 const PROMPT = ">>> "
+
+// engines the REPL can run code with
+const (
+	EngineEval = "eval"
+	EngineVM   = "vm"
+)
 const MONKEY = `           __,__
   .--.  .-"     "-.  .--.
  / .. \/  .-. .-.  \/ .. \
@@ -24,9 +32,14 @@ const MONKEY = `           __,__
           '-----'
 `
 
-func Start(in io.Reader, out io.Writer) {
+func Start(in io.Reader, out io.Writer, engine string) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	macroEnv := object.NewEnvironment()
+
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbolTable := compiler.NewSymbolTableWithBuiltins()
 
 	for {
 		fmt.Print(PROMPT)
@@ -50,7 +63,35 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		result := eval.Eval(program, env)
+		eval.DefineMacros(program, macroEnv)
+		expanded, err := eval.ExpandMacros(program, macroEnv)
+		if err != nil {
+			io.WriteString(out, "ERROR: "+err.Error()+"\n")
+			continue
+		}
+
+		if engine == EngineVM {
+			comp := compiler.NewWithState(symbolTable, constants)
+			if err := comp.Compile(expanded); err != nil {
+				io.WriteString(out, "ERROR: "+err.Error()+"\n")
+				continue
+			}
+
+			bytecode := comp.Bytecode()
+			constants = bytecode.Constants
+
+			machine := vm.NewWithGlobalsStore(bytecode, globals)
+			if err := machine.Run(); err != nil {
+				io.WriteString(out, "ERROR: "+err.Error()+"\n")
+				continue
+			}
+
+			io.WriteString(out, machine.LastPoppedStackElem().Inspect())
+			io.WriteString(out, "\n")
+			continue
+		}
+
+		result := eval.Eval(expanded, env)
 		if result != nil {
 			io.WriteString(out, result.Inspect())
 			io.WriteString(out, "\n")
@@ -5,6 +5,10 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+
+	// where the token starts in the source, counting from 1
+	Line   int
+	Column int
 }
 
 const (
@@ -25,19 +29,29 @@ const (
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	DOT       = "."
 
 	LPAREN   = "("
 	RPAREN   = ")"
 	LBRACE   = "{"
+	SET      = "#{"
 	RBRACE   = "}"
 	LBRACKET = "["
 	RBRACKET = "]"
 
 	FUNCTION = "FUNCTION"
+	MACRO    = "MACRO"
 	LET      = "LET"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	AS       = "AS"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
 
 	TRUE  = "TRUE"
 	FALSE = "FALSE"
@@ -47,16 +61,34 @@ const (
 
 	EQUAL     = "=="
 	NOT_EQUAL = "!="
+
+	RANGE           = ".."
+	RANGE_INCLUSIVE = "..="
+	ARROW           = "=>"
+	PIPE            = "|>"
+	COMPOSE         = ">>"
+	IN              = "IN"
+	FOR             = "FOR"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"true":   TRUE,
-	"false":  FALSE,
+	"fn":      FUNCTION,
+	"macro":   MACRO,
+	"let":     LET,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"true":    TRUE,
+	"false":   FALSE,
+	"for":     FOR,
+	"in":      IN,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"as":      AS,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"throw":   THROW,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,817 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+	"strings"
+)
+
+const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+)
+
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // always points to the next free slot, top of stack is stack[sp-1]
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
+
+	methods map[object.ObjectType]map[string]*object.Builtin
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants: bytecode.Constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals: make([]object.Object, GlobalsSize),
+
+		frames:      frames,
+		framesIndex: 1,
+
+		methods: object.MethodTable(object.Builtins),
+	}
+}
+
+// NewWithGlobalsStore creates a vm that shares its globals with earlier runs,
+// e.g. across lines entered in the REPL.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// LastPoppedStackElem returns the value of the last expression statement run,
+// which is the result of the program.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) Run() error {
+	return vm.run(0)
+}
+
+// run executes instructions until the frame stack drops back to depth, or the
+// main frame runs out of instructions.
+func (vm *VM) run(depth int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.framesIndex > depth {
+		frame := vm.currentFrame()
+		if frame.ip >= len(frame.Instructions())-1 {
+			return nil
+		}
+
+		frame.ip++
+
+		ip = frame.ip
+		ins = frame.Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpRange, code.OpRangeInclusive, code.OpIn:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+
+		case code.OpCompose:
+			if err := vm.executeComposeOperation(); err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			if err := vm.push(TRUE); err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(FALSE); err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			if err := vm.push(NULL); err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			if err := vm.executeBangOperator(); err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			if err := vm.executeMinusOperator(); err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				frame.ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			global := vm.globals[globalIndex]
+			if global == nil {
+				// hoisted function that hasn't been defined yet
+				global = NULL
+			}
+
+			if err := vm.push(global); err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			if err := vm.push(vm.stack[frame.basePointer+int(localIndex)]); err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			if err := vm.push(object.Builtins[builtinIndex].Builtin); err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			if err := vm.push(frame.cl.Free[freeIndex]); err != nil {
+				return err
+			}
+
+		case code.OpCurrentClosure:
+			if err := vm.push(frame.cl); err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(array); err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(hash); err != nil {
+				return err
+			}
+
+		case code.OpSet:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			set, err := vm.buildSet(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(set); err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			if err := vm.executeCall(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			if vm.framesIndex == 1 {
+				// top-level return ends the program, leaving returnValue as
+				// the last popped element
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(NULL); err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+
+		case code.OpIter:
+			iterable := vm.pop()
+
+			iter, ok := object.NewIterator(iterable)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", iterable.Type())
+			}
+
+			if err := vm.push(iter); err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			iter := vm.stack[vm.sp-1].(*object.Iterator)
+			elem, ok := iter.Next()
+			if !ok {
+				vm.pop()
+				frame.ip = pos - 1
+				continue
+			}
+
+			if err := vm.push(elem); err != nil {
+				return err
+			}
+
+		case code.OpMethod:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			if err := vm.executeMethod(vm.constants[nameIndex].(*object.String).Value); err != nil {
+				return err
+			}
+
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("opcode %s not implemented", def.Name)
+		}
+	}
+
+	return nil
+}
+
+// stack :)
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// frames :)
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// calls :)
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+// executeMethod swaps the value on top of the stack for its method name and
+// the value again, to be passed first when the method is called.
+func (vm *VM) executeMethod(name string) error {
+	receiver := vm.pop()
+
+	method, ok := vm.methods[receiver.Type()][name]
+	if !ok {
+		return fmt.Errorf("%s has no method: %s", receiver.Type(), name)
+	}
+
+	if err := vm.push(method); err != nil {
+		return err
+	}
+	return vm.push(receiver)
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments. got=%d, expected=%d", numArgs, cl.Fn.NumParameters)
+	}
+
+	basePointer := vm.sp - numArgs
+	if basePointer+cl.Fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	if err := vm.pushFrame(NewFrame(cl, basePointer)); err != nil {
+		return err
+	}
+
+	vm.sp = basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	result := builtin.Call(vm.callback, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if err, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", err.Message)
+	}
+
+	if result == nil {
+		result = NULL
+	}
+
+	return vm.push(result)
+}
+
+// callback is the Caller builtins like map are given, so the functions they
+// call run on vm.
+func (vm *VM) callback(fn object.Object, args ...object.Object) object.Object {
+	result, err := vm.callValue(fn, args)
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return result
+}
+
+// callValue calls fn with args and runs it to completion, so Go code (such as
+// composed functions) can call back into Monkey functions.
+func (vm *VM) callValue(fn object.Object, args []object.Object) (object.Object, error) {
+	if err := vm.push(fn); err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return nil, err
+		}
+	}
+
+	depth := vm.framesIndex
+	if err := vm.executeCall(len(args)); err != nil {
+		return nil, err
+	}
+
+	if vm.framesIndex > depth {
+		if err := vm.run(depth); err != nil {
+			return nil, err
+		}
+	}
+
+	return vm.pop(), nil
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+// operators :)
+var operators = map[code.Opcode]string{
+	code.OpAdd:            "+",
+	code.OpSub:            "-",
+	code.OpMul:            "*",
+	code.OpDiv:            "/",
+	code.OpEqual:          "==",
+	code.OpNotEqual:       "!=",
+	code.OpGreaterThan:    ">",
+	code.OpLessThan:       "<",
+	code.OpRange:          "..",
+	code.OpRangeInclusive: "..=",
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if op == code.OpIn {
+		return vm.executeInOperation(left, right)
+	}
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case leftType == object.BOOLEAN_OBJ && rightType == object.BOOLEAN_OBJ:
+		return vm.executeBinaryBooleanOperation(op, left, right)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	case op == code.OpEqual:
+		return vm.push(boolConvert(object.Equal(left, right)))
+	case op == code.OpNotEqual:
+		return vm.push(boolConvert(!object.Equal(left, right)))
+	default:
+		return fmt.Errorf("type mismatch: %s %s %s", leftType, operators[op], rightType)
+	}
+}
+
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Integer{Value: leftValue + rightValue})
+	case code.OpSub:
+		return vm.push(&object.Integer{Value: leftValue - rightValue})
+	case code.OpMul:
+		return vm.push(&object.Integer{Value: leftValue * rightValue})
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		return vm.push(&object.Integer{Value: leftValue / rightValue})
+	case code.OpEqual:
+		return vm.push(boolConvert(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(boolConvert(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(boolConvert(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(boolConvert(leftValue < rightValue))
+	case code.OpRange:
+		return vm.push(&object.Range{Start: leftValue, End: rightValue})
+	case code.OpRangeInclusive:
+		if rightValue == math.MaxInt64 {
+			return fmt.Errorf("inclusive range end out of bounds: %d", rightValue)
+		}
+		return vm.push(&object.Range{Start: leftValue, End: rightValue + 1, Inclusive: true})
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func (vm *VM) executeBinaryBooleanOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Boolean).Value
+	rightValue := right.(*object.Boolean).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(boolConvert(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(boolConvert(leftValue != rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.String{Value: leftValue + rightValue})
+	case code.OpEqual:
+		return vm.push(boolConvert(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(boolConvert(leftValue != rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func (vm *VM) executeInOperation(left, right object.Object) error {
+	switch right := right.(type) {
+	case *object.Range:
+		value, ok := left.(*object.Integer)
+		return vm.push(boolConvert(ok && right.Contains(value.Value)))
+
+	case *object.Array:
+		for _, elem := range right.Elements() {
+			if object.Equal(left, elem) {
+				return vm.push(TRUE)
+			}
+		}
+		return vm.push(FALSE)
+
+	case *object.Hash:
+		if _, ok := object.HashKeyOf(left); !ok {
+			return fmt.Errorf("unusable type given as hash key: %s", left.Type())
+		}
+		_, ok := right.Get(left)
+		return vm.push(boolConvert(ok))
+
+	case *object.Set:
+		if _, ok := object.HashKeyOf(left); !ok {
+			return fmt.Errorf("unusable type given as set element: %s", left.Type())
+		}
+		return vm.push(boolConvert(right.Contains(left)))
+
+	case *object.ErrorValue:
+		name, ok := left.(*object.String)
+		if !ok {
+			return vm.push(FALSE)
+		}
+		_, ok = right.Field(name.Value)
+		return vm.push(boolConvert(ok))
+
+	case *object.String:
+		substr, ok := left.(*object.String)
+		if !ok {
+			return fmt.Errorf("type mismatch: %s in %s", left.Type(), right.Type())
+		}
+		return vm.push(boolConvert(strings.Contains(right.Value, substr.Value)))
+
+	default:
+		return fmt.Errorf("unknown operator: %s in %s", left.Type(), right.Type())
+	}
+}
+
+func (vm *VM) executeComposeOperation() error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if !isCallable(left) || !isCallable(right) {
+		return fmt.Errorf("type mismatch: %s >> %s", left.Type(), right.Type())
+	}
+
+	return vm.push(object.Compose(left, right))
+}
+
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case TRUE:
+		return vm.push(FALSE)
+	case FALSE:
+		return vm.push(TRUE)
+	case NULL:
+		return vm.push(TRUE)
+	default:
+		return vm.push(FALSE)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	if operand.Type() != object.INTEGER_OBJ {
+		return fmt.Errorf("unknown operator: -%s", operand.Type())
+	}
+
+	value := operand.(*object.Integer).Value
+	return vm.push(&object.Integer{Value: -value})
+}
+
+// collections :)
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return object.NewArray(elements)
+}
+
+func (vm *VM) buildSet(startIndex, endIndex int) (object.Object, error) {
+	set := object.NewSet()
+
+	for i := startIndex; i < endIndex; i++ {
+		if !set.Add(vm.stack[i]) {
+			return nil, fmt.Errorf("unusable type given as set element: %s", vm.stack[i].Type())
+		}
+	}
+
+	return set, nil
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hash := object.NewHash()
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		if !hash.Set(key, value) {
+			return nil, fmt.Errorf("unusable type given as hash key: %s", key.Type())
+		}
+	}
+
+	return hash, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeRangeIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	case left.Type() == object.ERROR_VALUE_OBJ && index.Type() == object.STRING_OBJ:
+		field, ok := left.(*object.ErrorValue).Field(index.(*object.String).Value)
+		if !ok {
+			return vm.push(NULL)
+		}
+		return vm.push(field)
+	default:
+		return fmt.Errorf("index operator not supported for type: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	i := index.(*object.Integer).Value
+	max := int64(arrayObject.Len() - 1)
+
+	if i < 0 || i > max {
+		return vm.push(NULL)
+	}
+
+	elem, _ := arrayObject.At(int(i))
+	return vm.push(elem)
+}
+
+func (vm *VM) executeRangeIndex(rng, index object.Object) error {
+	value, ok := rng.(*object.Range).At(index.(*object.Integer).Value)
+	if !ok {
+		return vm.push(NULL)
+	}
+
+	return vm.push(&object.Integer{Value: value})
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	if _, ok := object.HashKeyOf(index); !ok {
+		return fmt.Errorf("unusable type given as hash key: %s", index.Type())
+	}
+
+	value, ok := hashObject.Get(index)
+	if !ok {
+		return vm.push(NULL)
+	}
+
+	return vm.push(value)
+}
+
+// helpers :)
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL, FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Closure, *object.Builtin:
+		return true
+	default:
+		return false
+	}
+}
+
+func boolConvert(value bool) *object.Boolean {
+	if value {
+		return TRUE
+	}
+	return FALSE
+}
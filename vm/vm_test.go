@@ -0,0 +1,162 @@
+package vm
+
+import (
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+// Most of the vm's behaviour is covered by the evaluator's test suite, which
+// runs against both backends (see eval.TestVMConformance). These tests cover
+// what only the vm does.
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			`let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } }; fib(15)`,
+			610,
+		},
+		{
+			`let wrapper = fn() {
+				let countDown = fn(x) { if (x == 0) { 0 } else { countDown(x - 1) } };
+				countDown(5);
+			};
+			wrapper();`,
+			0,
+		},
+		{
+			`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+			let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+			if (isEven(10)) { 1 } else { 0 }`,
+			1,
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := run(tt.input)
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testIntegerObject(t, result, tt.expected)
+	}
+}
+
+func TestComposeWithClosures(t *testing.T) {
+	input := `
+	let adder = fn(x) { fn(y) { x + y } };
+	let pipeline = adder(1) >> adder(10) >> adder(100);
+	pipeline(1) + pipeline(2)`
+
+	result, err := run(input)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testIntegerObject(t, result, 225)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(a) { a }(1, 2)`, "wrong number of arguments. got=2, expected=1"},
+		{`1(2)`, "not a function: INTEGER"},
+		{`let f = fn(x) { f(x + 1) }; f(0)`, "stack overflow"},
+		{`let f = fn(x) { 1 + x }; (f >> f)(true)`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		_, err := run(tt.input)
+		if err == nil {
+			t.Errorf("expected vm error %q, got none", tt.expected)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong vm error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestGlobalsStore(t *testing.T) {
+	globals := make([]object.Object, GlobalsSize)
+	symbolTable := compiler.NewSymbolTableWithBuiltins()
+	constants := []object.Object{}
+
+	var result object.Object
+	for _, line := range []string{"let a = 5;", "let b = a * 2;", "a + b"} {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(line)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobalsStore(bytecode, globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		result = machine.LastPoppedStackElem()
+	}
+
+	testIntegerObject(t, result, 15)
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	program := parse(`let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } }; fib(20)`)
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+
+	for i := 0; i < b.N; i++ {
+		machine := New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			b.Fatalf("vm error: %s", err)
+		}
+	}
+}
+
+// helpers :)
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func run(input string) (object.Object, error) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		return nil, err
+	}
+
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+
+	return machine.LastPoppedStackElem(), nil
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong Value. got=%d, expected=%d", result.Value, expected)
+		return false
+	}
+
+	return true
+}